@@ -3,7 +3,9 @@ package api
 import (
 	"context"
 	"errors"
-  "math/rand"
+	"fmt"
+	"math/rand"
+	"net/http"
 
 	"github.com/haykh/nogo/config"
 	"github.com/haykh/nogo/utils"
@@ -12,40 +14,98 @@ import (
 	notionapi "github.com/jomei/notionapi"
 )
 
-func InitAPI() (*notionapi.Client, string, error) {
+func initClient() (NotionAPI, config.LocalParseTemplate, error) {
 	if loc_config, err := config.CreateOrReadLocalConfig(true); err != nil {
-		return nil, "", err
+		return nil, config.LocalParseTemplate{}, err
 	} else {
 		if token, err := loc_config.GetSecret("api_token"); err != nil {
-			return nil, "", err
+			return nil, config.LocalParseTemplate{}, err
 		} else {
-			if stackID, err := loc_config.GetSecret("stack_page_id"); err != nil {
-				return nil, "", err
-			} else {
-				return NewClient(token), stackID, nil
-			}
+			return historyClient{NewClient(token)}, loc_config, nil
+		}
+	}
+}
+
+func InitClient() (NotionAPI, config.LocalParseTemplate, error) {
+	if client, loc_config, err := initClient(); err != nil {
+		return nil, config.LocalParseTemplate{}, err
+	} else {
+		return withDryRun(client), loc_config, nil
+	}
+}
+
+func InitAPI(stack string) (NotionAPI, string, error) {
+	client, _, stackID, err := InitStack(stack)
+	return client, stackID, err
+}
+
+// InitStack is InitAPI that also returns the config it read.
+func InitStack(stack string) (NotionAPI, config.LocalParseTemplate, string, error) {
+	if client, loc_config, err := initClient(); err != nil {
+		return nil, config.LocalParseTemplate{}, "", err
+	} else {
+		if stackID, err := loc_config.GetStackID(stack); err != nil {
+			return nil, config.LocalParseTemplate{}, "", err
+		} else if client, err := NewCacheClient(client, stackID); err != nil {
+			return nil, config.LocalParseTemplate{}, "", err
+		} else {
+			return withDryRun(client), loc_config, stackID, nil
 		}
 	}
 }
 
-func NewClient(token string) *notionapi.Client {
-	return notionapi.NewClient(notionapi.Token(token))
+// NewClient talks to Notion through a rate-limited, retrying transport; the
+// built-in 429 handling of notionapi is turned off in favor of it.
+func NewClient(token string) NotionAPI {
+	return newClient(token, http.DefaultTransport)
+}
+
+func newClient(token string, base http.RoundTripper) *notionClient {
+	httpClient := &http.Client{Transport: newRetryTransport(base)}
+	return &notionClient{
+		client: notionapi.NewClient(
+			notionapi.Token(token),
+			notionapi.WithHTTPClient(httpClient),
+			notionapi.WithRetry(1),
+		),
+		http:    httpClient,
+		timeout: Timeout,
+	}
+}
+
+func requireInteractive(what string) error {
+	if !utils.IsInteractive() {
+		return fmt.Errorf("no %s given and stdin is not a terminal", what)
+	}
+	return nil
 }
 
-func AddToStack(client *notionapi.Client, pageID string) error {
+// AddToStack appends a to-do; a non-nil due replaces any `@due(...)` in it.
+func AddToStack(client NotionAPI, pageID string, new_item string, due *notionapi.Date) error {
 	if parent, err := GetStack(client, pageID); err != nil {
 		return err
 	} else {
-		new_item := ""
-		if err := survey.AskOne(&survey.Input{
-			Message: "new entry:",
-		}, &new_item); err != nil {
-			return err
+		if new_item == "" {
+			if err := requireInteractive("entry"); err != nil {
+				return err
+			}
+			if err := survey.AskOne(&survey.Input{
+				Message: "new entry:",
+			}, &new_item); err != nil {
+				return err
+			}
 		}
 		if new_item == "" {
 			return errors.New("empty entry")
 		}
-		if _, err := client.Block.AppendChildren(context.Background(), parent.GetID(), &notionapi.AppendBlockChildrenRequest{
+		rts, err := EntryRichText(new_item)
+		if err != nil {
+			return err
+		}
+		if due != nil {
+			rts = WithDue(rts, due)
+		}
+		if _, err := client.AppendBlockChildren(context.Background(), parent.GetID(), &notionapi.AppendBlockChildrenRequest{
 			Children: []notionapi.Block{
 				&notionapi.ToDoBlock{
 					BasicBlock: notionapi.BasicBlock{
@@ -53,14 +113,8 @@ func AddToStack(client *notionapi.Client, pageID string) error {
 						Type:   notionapi.BlockTypeToDo,
 					},
 					ToDo: notionapi.ToDo{
-						RichText: []notionapi.RichText{
-							{
-								Text: &notionapi.Text{
-									Content: new_item,
-								},
-							},
-						},
-						Checked: false,
+						RichText: rts,
+						Checked:  false,
 					},
 				},
 			},
@@ -72,7 +126,9 @@ func AddToStack(client *notionapi.Client, pageID string) error {
 	}
 }
 
-func ModifyStack(client *notionapi.Client, pageID string) error {
+// ModifyStack rewrites an entry; with a due date and no new text only the
+// due date of the entry changes.
+func ModifyStack(client NotionAPI, pageID string, sel Selector, new_item string, due *notionapi.Date) error {
 	if blocks, err := GetStackEntries(client, pageID); err != nil {
 		return err
 	} else {
@@ -80,40 +136,73 @@ func ModifyStack(client *notionapi.Client, pageID string) error {
 			return err
 		} else {
 			idx := -1
-			if err := survey.AskOne(
-				&survey.Select{
-					Message: "modify:",
-					Options: *stack,
-				},
-				&idx,
-				survey.WithPageSize(10),
-			); err != nil {
-				return err
+			if sel.Interactive() {
+				if err := requireInteractive("entry selector"); err != nil {
+					return err
+				}
+				options, err := sel.Options(blocks)
+				if err != nil {
+					return err
+				}
+				pick := -1
+				if err := survey.AskOne(
+					&survey.Select{
+						Message: "modify:",
+						Options: labels(*stack, options),
+					},
+					&pick,
+					survey.WithPageSize(10),
+				); err != nil {
+					return err
+				}
+				idx = options[pick]
+			} else {
+				if selected, err := SelectEntries(blocks, *plain, sel); err != nil {
+					return err
+				} else if len(selected) != 1 {
+					return fmt.Errorf("expected exactly one entry to modify, got %d", len(selected))
+				} else {
+					idx = selected[0]
+				}
 			}
 			if idx == -1 {
 				return errors.New("no selection")
 			}
-			new_item := ""
-			if err := survey.AskOne(&survey.Input{
-				Message: "new entry:",
-				Suggest: func(string) []string {
-					return []string{(*plain)[idx]}
-				},
-			}, &new_item); err != nil {
-				return err
+			todo, ok := blocks[idx].(*notionapi.ToDoBlock)
+			if !ok {
+				return fmt.Errorf("entry %d is a %s block, not a to-do", idx+1, blocks[idx].GetType())
+			}
+			if new_item == "" && due == nil {
+				if err := requireInteractive("new entry"); err != nil {
+					return err
+				}
+				if err := survey.AskOne(&survey.Input{
+					Message: "new entry:",
+					Suggest: func(string) []string {
+						return []string{EntryText(BlockRichText(blocks[idx]))}
+					},
+				}, &new_item); err != nil {
+					return err
+				}
+				if new_item == "" {
+					return errors.New("empty entry")
+				}
+			}
+			rts := BlockRichText(blocks[idx])
+			if new_item != "" {
+				if parsed, err := EntryRichText(new_item); err != nil {
+					return err
+				} else {
+					rts = parsed
+				}
 			}
-			if new_item == "" {
-				return errors.New("empty entry")
+			if due != nil {
+				rts = WithDue(rts, due)
 			}
-			if _, err := client.Block.Update(context.Background(), blocks[idx].GetID(), &notionapi.BlockUpdateRequest{
+			if _, err := client.UpdateBlock(withBefore(context.Background(), todo), todo.GetID(), &notionapi.BlockUpdateRequest{
 				ToDo: &notionapi.ToDo{
-					RichText: []notionapi.RichText{
-						{
-							Text: &notionapi.Text{
-								Content: new_item,
-							},
-						},
-					},
+					RichText: rts,
+					Checked:  todo.ToDo.Checked,
 				},
 			}); err != nil {
 				return err
@@ -124,31 +213,50 @@ func ModifyStack(client *notionapi.Client, pageID string) error {
 	}
 }
 
-func RmFromStack(client *notionapi.Client, pageID string) error {
+func RmFromStack(client NotionAPI, pageID string, sel Selector) error {
 	if blocks, err := GetStackEntries(client, pageID); err != nil {
 		return err
 	} else {
-		if stack, _, _, err := ParseStackFromBlocks(client, blocks, pageID); err != nil {
+		if stack, plain, _, err := ParseStackFromBlocks(client, blocks, pageID); err != nil {
 			return err
 		} else {
 			torm := []int{}
-			if err := survey.AskOne(
-				&survey.MultiSelect{
-					Message: "pick to rm:",
-					Options: *stack,
-				},
-				&torm,
-				survey.WithPageSize(10),
-				survey.WithIcons(func(icons *survey.IconSet) {
-					icons.MarkedOption.Text = "✖"
-					icons.MarkedOption.Format = "red"
-					icons.UnmarkedOption.Text = " "
-				}),
-			); err != nil {
-				return err
+			if sel.Interactive() {
+				if err := requireInteractive("entry selector"); err != nil {
+					return err
+				}
+				options, err := sel.Options(blocks)
+				if err != nil {
+					return err
+				}
+				picked := []int{}
+				if err := survey.AskOne(
+					&survey.MultiSelect{
+						Message: "pick to rm:",
+						Options: labels(*stack, options),
+					},
+					&picked,
+					survey.WithPageSize(10),
+					survey.WithIcons(func(icons *survey.IconSet) {
+						icons.MarkedOption.Text = "✖"
+						icons.MarkedOption.Format = "red"
+						icons.UnmarkedOption.Text = " "
+					}),
+				); err != nil {
+					return err
+				}
+				for _, i := range picked {
+					torm = append(torm, options[i])
+				}
+			} else {
+				if selected, err := SelectEntries(blocks, *plain, sel); err != nil {
+					return err
+				} else {
+					torm = selected
+				}
 			}
 			for _, idx := range torm {
-				if _, err := client.Block.Delete(context.Background(), blocks[idx].GetID()); err != nil {
+				if _, err := client.DeleteBlock(context.Background(), blocks[idx].GetID()); err != nil {
 					return err
 				}
 			}
@@ -157,50 +265,109 @@ func RmFromStack(client *notionapi.Client, pageID string) error {
 	}
 }
 
-func ToggleStack(client *notionapi.Client, pageID string) error {
+// setSubtasks checks or unchecks every to-do nested under the block.
+func setSubtasks(client NotionAPI, blockID notionapi.BlockID, checked bool) error {
+	return ForEachChild(client, blockID, func(b notionapi.Block) error {
+		if todo, ok := b.(*notionapi.ToDoBlock); ok && todo.ToDo.Checked != checked {
+			request := todo.ToDo
+			request.Checked = checked
+			if _, err := client.UpdateBlock(
+				withBefore(context.Background(), b),
+				b.GetID(),
+				&notionapi.BlockUpdateRequest{
+					ToDo: &request,
+				}); err != nil {
+				return err
+			}
+		}
+		if b.GetHasChildren() {
+			return setSubtasks(client, b.GetID(), checked)
+		}
+		return nil
+	})
+}
+
+// ToggleStack flips the selected entries; with subtasks the nested to-dos of
+// a toggled entry follow its new state.
+func ToggleStack(client NotionAPI, pageID string, sel Selector, subtasks bool) error {
 	if blocks, err := GetStackEntries(client, pageID); err != nil {
 		return err
 	} else {
 		if _, stack, marked, err := ParseStackFromBlocks(client, blocks, pageID); err != nil {
 			return err
 		} else {
-			preselect := []string{}
-			for i, m := range *marked {
-				if m {
-					preselect = append(preselect, (*stack)[i])
-				}
-			}
 			selected := []int{}
-			if err := survey.AskOne(
-				&survey.MultiSelect{
-					Message: "toggle:",
-					Options: *stack,
-					Default: preselect,
-				},
-				&selected,
-				survey.WithPageSize(10),
+			if sel.Interactive() {
+				if err := requireInteractive("entry selector"); err != nil {
+					return err
+				}
+				options, err := sel.Options(blocks)
+				if err != nil {
+					return err
+				}
+				preselect := []string{}
+				for mi, m := range *marked {
+					if m && utils.IsIn(mi, options) {
+						preselect = append(preselect, (*stack)[mi])
+					} else if m {
+						// entries filtered out keep their state
+						selected = append(selected, mi)
+					}
+				}
+				picked := []int{}
+				if err := survey.AskOne(
+					&survey.MultiSelect{
+						Message: "toggle:",
+						Options: labels(*stack, options),
+						Default: preselect,
+					},
+					&picked,
+					survey.WithPageSize(10),
 
-				survey.WithIcons(func(icons *survey.IconSet) {
-					icons.MarkedOption.Text = "[✓]"
-					icons.MarkedOption.Format = "green"
-					icons.UnmarkedOption.Text = "[ ]"
-				}),
-			); err != nil {
-				return err
+					survey.WithIcons(func(icons *survey.IconSet) {
+						icons.MarkedOption.Text = "[✓]"
+						icons.MarkedOption.Format = "green"
+						icons.UnmarkedOption.Text = "[ ]"
+					}),
+				); err != nil {
+					return err
+				}
+				for _, i := range picked {
+					selected = append(selected, options[i])
+				}
+			} else {
+				if toflip, err := SelectEntries(blocks, *stack, sel); err != nil {
+					return err
+				} else {
+					for mi, m := range *marked {
+						if m != utils.IsIn(mi, toflip) {
+							selected = append(selected, mi)
+						}
+					}
+				}
 			}
 			for mi, m := range *marked {
 				isin := utils.IsIn(mi, selected)
 				if (!m && isin) || (m && !isin) {
-					request := blocks[mi].(*notionapi.ToDoBlock).ToDo
+					todo, ok := blocks[mi].(*notionapi.ToDoBlock)
+					if !ok {
+						return fmt.Errorf("entry %d is a %s block, not a to-do", mi+1, blocks[mi].GetType())
+					}
+					request := todo.ToDo
 					request.Checked = isin
-					if _, err := client.Block.Update(
-						context.Background(),
+					if _, err := client.UpdateBlock(
+						withBefore(context.Background(), blocks[mi]),
 						blocks[mi].GetID(),
 						&notionapi.BlockUpdateRequest{
 							ToDo: &request,
 						}); err != nil {
 						return err
 					}
+					if subtasks && blocks[mi].GetHasChildren() {
+						if err := setSubtasks(client, blocks[mi].GetID(), isin); err != nil {
+							return err
+						}
+					}
 				}
 			}
 			return nil
@@ -208,36 +375,57 @@ func ToggleStack(client *notionapi.Client, pageID string) error {
 	}
 }
 
-func RandomStackEntry(client *notionapi.Client, pageID string) error {
-  if blocks, err := GetStackEntries(client, pageID); err != nil {
-    return err
-  } else {
-    if _, stack, _, err := ParseStackFromBlocks(client, blocks, pageID); err != nil {
-      return err
-    } else {
-      if len(*stack) == 0 {
-        return errors.New("empty stack")
-      }
-      for i := 0; i < 100; i++ {
-        idx := rand.Intn(len(*stack))
-        todo := blocks[idx].(*notionapi.ToDoBlock).ToDo
-        if !todo.Checked {
-          return ShowRichText(todo.RichText, string(utils.ColorGreen) + "Random ToDo: " + string(utils.ColorReset), 2)
-        } else {
-          continue
-        }
-      }
-      return errors.New("no unfinished tasks")
-    }
-  }
+func RandomStackEntry(client NotionAPI, pageID string) error {
+	if blocks, err := GetStackEntries(client, pageID); err != nil {
+		return err
+	} else {
+		if _, stack, _, err := ParseStackFromBlocks(client, blocks, pageID); err != nil {
+			return err
+		} else {
+			if len(*stack) == 0 {
+				return errors.New("empty stack")
+			}
+			for i := 0; i < 100; i++ {
+				idx := rand.Intn(len(*stack))
+				if todo, ok := blocks[idx].(*notionapi.ToDoBlock); !ok {
+					return fmt.Errorf("entry %d is a %s block, not a to-do", idx+1, blocks[idx].GetType())
+				} else if !todo.ToDo.Checked {
+					return ShowRichText(NewRenderContext(client).Indented(2), todo.ToDo.RichText, string(utils.ColorGreen)+"Random ToDo: "+string(utils.ColorReset))
+				}
+			}
+			return errors.New("no unfinished tasks")
+		}
+	}
 }
 
-func CreatePage(client *notionapi.Client, parentID string, title, icon string) (string, error) {
+func RegisterStack(client NotionAPI, loc_config config.LocalParseTemplate, name, ref string, makeDefault bool) error {
+	if name == "" {
+		return errors.New("empty stack name")
+	}
+	if pageID, err := ParseID(ref); err != nil {
+		return err
+	} else {
+		if page, err := client.GetPage(context.Background(), notionapi.PageID(pageID)); err != nil {
+			return fmt.Errorf("failed to get page: %w", err)
+		} else {
+			if _, err := GetStack(client, pageID); err != nil {
+				return fmt.Errorf("page has no stack block: %w", err)
+			}
+			if err := writeConfig(fmt.Sprintf("stack `%s` = %s", name, pageID), func() error {
+				return loc_config.SetStack(name, pageID, makeDefault)
+			}); err != nil {
+				return err
+			}
+			return ShowPageTitle(NewRenderContext(client), page)
+		}
+	}
+}
+
+func CreatePage(client NotionAPI, parentID string, title, icon string) (string, error) {
 	parent := notionapi.Parent{
 		Type:   "page_id",
 		PageID: notionapi.PageID(parentID),
 	}
-	emoji := notionapi.Emoji(icon)
 	pagerequest := notionapi.PageCreateRequest{
 		Parent: parent,
 		Properties: map[string]notionapi.Property{
@@ -252,12 +440,15 @@ func CreatePage(client *notionapi.Client, parentID string, title, icon string) (
 				},
 			},
 		},
-		Icon: &notionapi.Icon{
+	}
+	if icon != "" {
+		emoji := notionapi.Emoji(icon)
+		pagerequest.Icon = &notionapi.Icon{
 			Type:  "emoji",
 			Emoji: &emoji,
-		},
+		}
 	}
-	if newpage, err := client.Page.Create(context.Background(), &pagerequest); err != nil {
+	if newpage, err := client.CreatePage(context.Background(), &pagerequest); err != nil {
 		return "", err
 	} else {
 		return string(newpage.ID), nil
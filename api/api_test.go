@@ -0,0 +1,175 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// stackTest runs a command against a stack of the given entries and compares
+// the stack it leaves behind (see stackState).
+type stackTest struct {
+	name    string
+	entries []notion.Block
+	run     func(client NotionAPI, pageID string) error
+	want    []string
+	wantErr string
+}
+
+func runStackTests(t *testing.T, tests []stackTest) {
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, pageID := newStack(t, tt.entries...)
+			err := tt.run(f, pageID)
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+			if got := stackState(t, f, pageID); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got stack\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestStackCommands(t *testing.T) {
+	runStackTests(t, []stackTest{
+		{
+			name:    "add",
+			entries: []notion.Block{todo("buy milk", false)},
+			run: func(client NotionAPI, pageID string) error {
+				return AddToStack(client, pageID, "call bob", nil)
+			},
+			want: []string{"[ ] buy milk", "[ ] call bob"},
+		},
+		{
+			name: "add to an empty stack",
+			run: func(client NotionAPI, pageID string) error {
+				return AddToStack(client, pageID, "call bob", nil)
+			},
+			want: []string{"[ ] call bob"},
+		},
+		{
+			name: "mod by index",
+			entries: []notion.Block{
+				todo("buy milk", false),
+				todo("call bob", true),
+			},
+			run: func(client NotionAPI, pageID string) error {
+				return ModifyStack(client, pageID, Selector{Keys: []string{"2"}}, "call alice", nil)
+			},
+			want: []string{"[ ] buy milk", "[x] call alice"},
+		},
+		{
+			name: "mod by match",
+			entries: []notion.Block{
+				todo("buy milk", false),
+				todo("call bob", false),
+			},
+			run: func(client NotionAPI, pageID string) error {
+				return ModifyStack(client, pageID, Selector{Match: []string{"MILK"}}, "buy oat milk", nil)
+			},
+			want: []string{"[ ] buy oat milk", "[ ] call bob"},
+		},
+		{
+			name: "mod of several entries",
+			entries: []notion.Block{
+				todo("call bob", false),
+				todo("call alice", false),
+			},
+			run: func(client NotionAPI, pageID string) error {
+				return ModifyStack(client, pageID, Selector{Match: []string{"call"}}, "call", nil)
+			},
+			want:    []string{"[ ] call bob", "[ ] call alice"},
+			wantErr: "expected exactly one entry to modify, got 2",
+		},
+		{
+			name:    "mod of a block that is not a to-do",
+			entries: []notion.Block{todo("buy milk", false), paragraph("notes")},
+			run: func(client NotionAPI, pageID string) error {
+				return ModifyStack(client, pageID, Selector{Keys: []string{"2"}}, "call bob", nil)
+			},
+			want:    []string{"[ ] buy milk", "[ ] notes"},
+			wantErr: "entry 2 is a paragraph block, not a to-do",
+		},
+		{
+			name:    "toggle of a block that is not a to-do",
+			entries: []notion.Block{todo("buy milk", false), paragraph("notes")},
+			run: func(client NotionAPI, pageID string) error {
+				return ToggleStack(client, pageID, Selector{Keys: []string{"2"}}, false)
+			},
+			want:    []string{"[ ] buy milk", "[ ] notes"},
+			wantErr: "entry 2 is a paragraph block, not a to-do",
+		},
+		{
+			name:    "random of a block that is not a to-do",
+			entries: []notion.Block{paragraph("notes")},
+			run: func(client NotionAPI, pageID string) error {
+				return RandomStackEntry(client, pageID)
+			},
+			want:    []string{"[ ] notes"},
+			wantErr: "entry 1 is a paragraph block, not a to-do",
+		},
+		{
+			name: "rm by index and match",
+			entries: []notion.Block{
+				todo("buy milk", false),
+				todo("call bob", false),
+				todo("ship release", true),
+			},
+			run: func(client NotionAPI, pageID string) error {
+				return RmFromStack(client, pageID, Selector{Keys: []string{"1"}, Match: []string{"ship"}})
+			},
+			want: []string{"[ ] call bob"},
+		},
+		{
+			name:    "rm out of range",
+			entries: []notion.Block{todo("buy milk", false)},
+			run: func(client NotionAPI, pageID string) error {
+				return RmFromStack(client, pageID, Selector{Keys: []string{"2"}})
+			},
+			want:    []string{"[ ] buy milk"},
+			wantErr: "index 2 out of range [1, 1]",
+		},
+		{
+			name: "toggle",
+			entries: []notion.Block{
+				todo("buy milk", false),
+				todo("call bob", true),
+				todo("ship release", false),
+			},
+			run: func(client NotionAPI, pageID string) error {
+				return ToggleStack(client, pageID, Selector{Keys: []string{"1", "2"}}, false)
+			},
+			want: []string{"[x] buy milk", "[ ] call bob", "[ ] ship release"},
+		},
+	})
+}
+
+func TestToggleSubtasks(t *testing.T) {
+	runStackTests(t, []stackTest{
+		{
+			name: "toggle leaves sub-tasks",
+			entries: []notion.Block{
+				todo("release", false, todo("tag", false), todo("announce", true)),
+			},
+			run: func(client NotionAPI, pageID string) error {
+				return ToggleStack(client, pageID, Selector{Keys: []string{"1"}}, false)
+			},
+			want: []string{"[x] release", "  [ ] tag", "  [x] announce"},
+		},
+		{
+			name: "toggle with sub-tasks",
+			entries: []notion.Block{
+				todo("release", false, todo("tag", false, todo("push", false)), todo("announce", true)),
+			},
+			run: func(client NotionAPI, pageID string) error {
+				return ToggleStack(client, pageID, Selector{Keys: []string{"1"}}, true)
+			},
+			want: []string{"[x] release", "  [x] tag", "    [x] push", "  [x] announce"},
+		},
+	})
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haykh/nogo/config"
+	"github.com/haykh/nogo/utils"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// DoneTitle is the child page of a stack that archived entries go to.
+const DoneTitle = "Done"
+
+// ParseAge reads a duration like `7d`, `2w` or anything time.ParseDuration
+// accepts (`36h`).
+func ParseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, err := strconv.Atoi(strings.TrimSuffix(s, suffix)); err == nil && strings.HasSuffix(s, suffix) && n >= 0 {
+			return time.Duration(n) * unit, nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err != nil || d < 0 {
+		return 0, fmt.Errorf("cannot parse `%s` as an age (e.g. 7d, 2w, 36h)", s)
+	} else {
+		return d, nil
+	}
+}
+
+// weekTitle names the toggle an entry completed at t is filed under, e.g.
+// `2026-W42 · Oct 12 – Oct 18`.
+func weekTitle(t time.Time) string {
+	year, week := t.ISOWeek()
+	y, m, d := t.Date()
+	monday := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	monday = monday.AddDate(0, 0, -((int(monday.Weekday()) + 6) % 7))
+	return fmt.Sprintf("%d-W%02d · %s – %s", year, week, monday.Format("Jan 2"), monday.AddDate(0, 0, 6).Format("Jan 2"))
+}
+
+// doneLog files archived entries into week toggles of the Done page, creating
+// the page and toggles as needed.
+type doneLog struct {
+	client NotionAPI
+	pageID string
+	done   notion.BlockID
+	weeks  map[string]notion.BlockID
+}
+
+func (l *doneLog) page() (notion.BlockID, error) {
+	if l.done != "" {
+		return l.done, nil
+	}
+	if err := ForEachChild(l.client, notion.BlockID(l.pageID), func(b notion.Block) error {
+		if child, ok := b.(*notion.ChildPageBlock); ok && child.ChildPage.Title == DoneTitle && l.done == "" {
+			l.done = b.GetID()
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	if l.done == "" {
+		if id, err := CreatePage(l.client, l.pageID, DoneTitle, "✅"); err != nil {
+			return "", fmt.Errorf("failed to create the %s page: %w", DoneTitle, err)
+		} else {
+			l.done = notion.BlockID(id)
+		}
+	}
+	return l.done, nil
+}
+
+func (l *doneLog) week(t time.Time) (notion.BlockID, error) {
+	title := weekTitle(t)
+	key := strings.SplitN(title, " ", 2)[0]
+	if id, ok := l.weeks[key]; ok {
+		return id, nil
+	}
+	done, err := l.page()
+	if err != nil {
+		return "", err
+	}
+	if err := ForEachChild(l.client, done, func(b notion.Block) error {
+		if toggle, ok := b.(*notion.ToggleBlock); ok {
+			if existing := RichText2Plain(toggle.Toggle.RichText); strings.HasPrefix(existing, key+" ") {
+				l.weeks[key] = b.GetID()
+			}
+		}
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	if id, ok := l.weeks[key]; ok {
+		return id, nil
+	}
+	if response, err := l.client.AppendBlockChildren(context.Background(), done, &notion.AppendBlockChildrenRequest{
+		Children: []notion.Block{
+			&notion.ToggleBlock{
+				BasicBlock: notion.BasicBlock{
+					Object: notion.ObjectTypeBlock,
+					Type:   notion.BlockTypeToggle,
+				},
+				Toggle: notion.Toggle{
+					RichText: []notion.RichText{textSpan(title, notion.ColorDefault)},
+				},
+			},
+		},
+	}); err != nil {
+		return "", err
+	} else {
+		l.weeks[key] = response.Results[0].GetID()
+		return l.weeks[key], nil
+	}
+}
+
+// file re-creates a checked entry (with its sub-tasks) in the toggle of the
+// week it was completed, noting the completion date after its text.
+func (l *doneLog) file(b notion.Block, completed time.Time) error {
+	week, err := l.week(completed)
+	if err != nil {
+		return err
+	}
+	clone, err := cloneBlock(b)
+	if err != nil {
+		return err
+	}
+	done := notion.Date(dateOnly(completed))
+	todo := clone.(*notion.ToDoBlock)
+	todo.ToDo.RichText = append(todo.ToDo.RichText, textSpan(" · done ", notion.ColorGray), DateMention(&done))
+	_, err = recreate(l.client, week, "", clone)
+	return err
+}
+
+// ArchiveStack moves the checked entries of a stack, completed at least
+// olderThan ago, to its Done page. Notion does not record when a to-do was
+// checked, so an entry counts as completed when it was last edited.
+func ArchiveStack(client NotionAPI, pageID string, olderThan time.Duration) (int, error) {
+	blocks, err := GetStackEntries(client, pageID)
+	if err != nil {
+		return 0, err
+	}
+	archive := &doneLog{client: client, pageID: pageID, weeks: map[string]notion.BlockID{}}
+	archived := 0
+	now := Now()
+	for _, b := range blocks {
+		todo, ok := b.(*notion.ToDoBlock)
+		if !ok || !todo.ToDo.Checked || b.GetLastEditedTime() == nil {
+			continue
+		}
+		completed := b.GetLastEditedTime().In(now.Location())
+		if now.Sub(completed) < olderThan {
+			continue
+		}
+		if err := archive.file(b, completed); err != nil {
+			return archived, err
+		} else if _, err := client.DeleteBlock(context.Background(), b.GetID()); err != nil {
+			return archived, err
+		}
+		archived++
+	}
+	return archived, nil
+}
+
+func ShowArchiveStack(client NotionAPI, pageID string, olderThan time.Duration) error {
+	if archived, err := ArchiveStack(client, pageID, olderThan); err != nil {
+		return err
+	} else if archived == 0 {
+		fmt.Println("nothing to archive")
+	} else {
+		fmt.Printf("%s✓ archived %d entries to `%s`%s\n", utils.ColorGreen, archived, DoneTitle, utils.ColorReset)
+	}
+	return nil
+}
+
+// AutoArchive archives entries checked longer ago than the configured
+// `auto_archive_after`, if any; it does nothing offline, be it with --offline
+// or because the client found notion unreachable.
+func AutoArchive(client NotionAPI, loc_config config.LocalParseTemplate, pageID string) error {
+	return autoArchive(client, loc_config.GetAutoArchiveAfter(), pageID)
+}
+
+// SetAutoArchiveAfter sets `auto_archive_after` in the config, `off` (or
+// empty) to turn auto-archiving off.
+func SetAutoArchiveAfter(loc_config config.LocalParseTemplate, after string) error {
+	if after != "" && after != "off" {
+		if _, err := ParseAge(after); err != nil {
+			return err
+		}
+	}
+	return writeConfig("auto_archive_after = "+after, func() error {
+		return loc_config.SetAutoArchiveAfter(after)
+	})
+}
+
+func autoArchive(client NotionAPI, after string, pageID string) error {
+	if after == "" || isOffline(client) {
+		return nil
+	}
+	if olderThan, err := ParseAge(after); err != nil {
+		return fmt.Errorf("auto_archive_after: %w", err)
+	} else {
+		_, err := ArchiveStack(client, pageID, olderThan)
+		return err
+	}
+}
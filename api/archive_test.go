@@ -0,0 +1,52 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAutoArchive(t *testing.T) {
+	defer func(now func() time.Time) { Now = now }(Now)
+	Now = func() time.Time { return time.Now().Add(30 * 24 * time.Hour) }
+	// offline clients as InitAPI makes them, with nothing cached
+	cache := func(f *FakeNotion, pageID string) *cacheClient {
+		c := newCacheClient(f, t.TempDir(), pageID, &Journal{})
+		c.offline = true
+		return c
+	}
+	tests := []struct {
+		name   string
+		client func(f *FakeNotion, pageID string) NotionAPI
+		want   []string
+	}{
+		{
+			name:   "online",
+			client: func(f *FakeNotion, pageID string) NotionAPI { return f },
+			want:   []string{"[ ] open"},
+		},
+		{
+			name:   "notion found unreachable",
+			client: func(f *FakeNotion, pageID string) NotionAPI { return cache(f, pageID) },
+			want:   []string{"[x] done", "[ ] open"},
+		},
+		{
+			name: "notion found unreachable in a dry run",
+			client: func(f *FakeNotion, pageID string) NotionAPI {
+				return &dryRunClient{NotionAPI: cache(f, pageID)}
+			},
+			want: []string{"[x] done", "[ ] open"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, pageID := newStack(t, todo("done", true), todo("open", false))
+			if err := autoArchive(tt.client(f, pageID), "7d", pageID); err != nil {
+				t.Fatal(err)
+			}
+			if got := stackState(t, f, pageID); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got stack %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	notion "github.com/jomei/notionapi"
+)
+
+func basicBlock(b notion.Block) *notion.BasicBlock {
+	v := reflect.ValueOf(b)
+	if v.Kind() != reflect.Pointer {
+		return nil
+	}
+	field := v.Elem().FieldByName("BasicBlock")
+	if !field.IsValid() {
+		return nil
+	}
+	return field.Addr().Interface().(*notion.BasicBlock)
+}
+
+// takeChildren detaches the nested children of a block (e.g. `ToDo.Children`),
+// which Notion creates as separate child blocks.
+func takeChildren(b notion.Block) notion.Blocks {
+	v := reflect.ValueOf(b).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() != reflect.Struct {
+			continue
+		}
+		if children := field.FieldByName("Children"); children.IsValid() && children.Type() == reflect.TypeOf(notion.Blocks{}) {
+			result := children.Interface().(notion.Blocks)
+			children.Set(reflect.Zero(children.Type()))
+			return result
+		}
+	}
+	return nil
+}
+
+// normalizeRichText fills in what Notion derives server-side: the rich text
+// type, its plain text and the default annotations.
+func normalizeRichText(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			normalizeRichText(v.Elem())
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			normalizeRichText(v.MapIndex(key))
+		}
+	case reflect.Slice:
+		if v.Type() == reflect.TypeOf([]notion.RichText{}) {
+			for i := 0; i < v.Len(); i++ {
+				rt := v.Index(i).Addr().Interface().(*notion.RichText)
+				if rt.Type == "" && rt.Text != nil {
+					rt.Type = notion.ObjectTypeText
+				}
+				if rt.PlainText == "" && rt.Text != nil {
+					rt.PlainText = rt.Text.Content
+				}
+				if rt.Annotations == nil {
+					rt.Annotations = &notion.Annotations{Color: notion.ColorDefault}
+				}
+			}
+		} else if v.Type() != reflect.TypeOf(notion.Blocks{}) {
+			for i := 0; i < v.Len(); i++ {
+				normalizeRichText(v.Index(i))
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				normalizeRichText(v.Field(i))
+			}
+		}
+	}
+}
+
+func cloneBlock(b notion.Block) (notion.Block, error) {
+	if data, err := json.Marshal([]notion.Block{b}); err != nil {
+		return nil, err
+	} else {
+		var blocks notion.Blocks
+		if err := json.Unmarshal(data, &blocks); err != nil {
+			return nil, err
+		}
+		return blocks[0], nil
+	}
+}
+
+// applyRequest updates a block in place the way notion applies an update.
+func applyRequest(block notion.Block, request *notion.BlockUpdateRequest) error {
+	target := reflect.ValueOf(block).Elem()
+	fields := reflect.ValueOf(request).Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		if field.IsNil() {
+			continue
+		}
+		name := fields.Type().Field(i).Name
+		if dst := target.FieldByName(name); !dst.IsValid() || dst.Type() != field.Elem().Type() {
+			return fmt.Errorf("cannot update `%s` of a %s block", name, block.GetType())
+		} else {
+			dst.Set(field.Elem())
+		}
+	}
+	normalizeRichText(reflect.ValueOf(block))
+	return nil
+}
@@ -0,0 +1,537 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/haykh/nogo/utils"
+
+	notion "github.com/jomei/notionapi"
+)
+
+var (
+	// Offline serves pages purely from the on-disk cache.
+	Offline bool
+	// Refresh ignores the cache and fetches everything again.
+	Refresh bool
+)
+
+var (
+	ErrNotCached   = errors.New("not available offline, run once without --offline to cache it")
+	errOfflineEdit = errors.New("cannot modify notion with --offline")
+)
+
+// notion rounds last_edited_time down to the minute, so a page cached within
+// a minute of its last edit may have changed without the timestamp moving.
+const editGranularity = time.Minute
+
+func CacheDir() (string, error) {
+	if dir, err := os.UserCacheDir(); err != nil {
+		return "", err
+	} else {
+		return filepath.Join(dir, "nogo"), nil
+	}
+}
+
+// cachedBlock is what the on-disk cache keeps of a block, stored under its
+// id: its children as fetched (by start cursor, empty for the first batch).
+// They are valid as long as the page the block is on (the block itself for
+// pages) has kept the last_edited_time it had when they were fetched: notion
+// bumps it for any change to the blocks of a page, though not for changes
+// inside its sub-pages, which are validated on their own.
+type cachedBlock struct {
+	Page     notion.BlockID                         `json:"page"`
+	Edited   time.Time                              `json:"edited"`
+	CachedAt time.Time                              `json:"cached_at"`
+	Children map[string]*notion.GetChildrenResponse `json:"children"`
+	// PageObject is kept for the page a cache client was made for, to show
+	// its title offline.
+	PageObject *notion.Page `json:"page_object,omitempty"`
+}
+
+func (b *cachedBlock) valid(page notion.BlockID, edited time.Time) bool {
+	return b.Page == page && b.Edited.Equal(edited) && b.CachedAt.Sub(b.Edited) >= editGranularity
+}
+
+func loadCachedBlock(path string) (*cachedBlock, error) {
+	b := &cachedBlock{}
+	if data, err := os.ReadFile(path); err != nil {
+		return nil, err
+	} else if err := json.Unmarshal(data, b); err != nil {
+		return nil, err
+	}
+	if b.Children == nil {
+		b.Children = map[string]*notion.GetChildrenResponse{}
+	}
+	return b, nil
+}
+
+func blockCacheDir() (string, error) {
+	if dir, err := CacheDir(); err != nil {
+		return "", err
+	} else {
+		return filepath.Join(dir, "blocks"), nil
+	}
+}
+
+// cacheClient serves blocks from the on-disk cache, falling back to (and
+// recording) the network for anything missing or outdated; what it fetched
+// is written once the command is done (see SaveCache). Writes go straight
+// through and drop what was cached of the blocks seen so far; offline (or
+// when notion is unreachable) they are journaled for `nogo sync` and shown
+// merged into the cached blocks meanwhile.
+type cacheClient struct {
+	NotionAPI
+	mu         sync.Mutex
+	dir        string
+	pageID     notion.PageID
+	pageObject *notion.Page
+	// blocks are the cached blocks loaded or fetched in this run, nil for
+	// the ones not on disk; dirty are the ones to write.
+	blocks map[notion.BlockID]*cachedBlock
+	dirty  map[notion.BlockID]bool
+	// page is the page each block seen in this run is on, edited the
+	// current last_edited_time of those pages.
+	page     map[notion.BlockID]notion.BlockID
+	edited   map[notion.BlockID]time.Time
+	journal  *Journal
+	offline  bool
+	notified bool
+}
+
+// opened are the cache clients of the running command, until SaveCache.
+var opened struct {
+	sync.Mutex
+	clients []*cacheClient
+}
+
+// isOffline reports whether the client works from the cache alone, with
+// --offline or since it found notion unreachable.
+func isOffline(client NotionAPI) bool {
+	if Offline {
+		return true
+	}
+	if d, ok := client.(*dryRunClient); ok {
+		client = d.NotionAPI
+	}
+	if c, ok := client.(*cacheClient); ok {
+		return c.isOffline()
+	}
+	return false
+}
+
+func (c *cacheClient) isOffline() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offline
+}
+
+func (c *cacheClient) goOffline() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offline = true
+}
+
+func newCacheClient(client NotionAPI, dir string, pageID string, journal *Journal) *cacheClient {
+	return &cacheClient{
+		NotionAPI: client,
+		dir:       dir,
+		pageID:    notion.PageID(pageID),
+		blocks:    map[notion.BlockID]*cachedBlock{},
+		dirty:     map[notion.BlockID]bool{},
+		page:      map[notion.BlockID]notion.BlockID{notion.BlockID(pageID): notion.BlockID(pageID)},
+		edited:    map[notion.BlockID]time.Time{},
+		journal:   journal,
+		offline:   Offline,
+	}
+}
+
+// NewCacheClient wraps client with the on-disk cache of the blocks of a page,
+// honoring Offline and Refresh. Unless offline, cached blocks are only used
+// if the page they are on has not been edited since (one GetPage round-trip
+// per page).
+func NewCacheClient(client NotionAPI, pageID string) (NotionAPI, error) {
+	dir, err := blockCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	journal, err := LoadJournal()
+	if err != nil {
+		return nil, err
+	}
+	c := newCacheClient(client, dir, pageID, journal)
+	root := notion.BlockID(pageID)
+	if Offline {
+		if cached := c.load(root); cached == nil {
+			return nil, fmt.Errorf("page %s: %w", pageID, ErrNotCached)
+		} else {
+			c.pageObject = cached.PageObject
+		}
+	} else if page, err := client.GetPage(context.Background(), c.pageID); err != nil {
+		if cached := c.load(root); !unreachable(err) || cached == nil {
+			return nil, err
+		} else {
+			c.offline = true
+			c.pageObject = cached.PageObject
+		}
+	} else {
+		c.pageObject = page
+		c.edited[root] = page.LastEditedTime
+	}
+	opened.Lock()
+	defer opened.Unlock()
+	opened.clients = append(opened.clients, c)
+	return c, nil
+}
+
+// SaveCache writes what the cache clients of the command fetched, once it is
+// done rather than after every request.
+func SaveCache() error {
+	opened.Lock()
+	clients := opened.clients
+	opened.clients = nil
+	opened.Unlock()
+	for _, c := range clients {
+		if err := c.save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DropCache removes what is cached of the blocks on a page.
+func DropCache(pageID string) error {
+	dir, err := blockCacheDir()
+	if err != nil {
+		return err
+	}
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+		if b, err := loadCachedBlock(path); err == nil && b.Page == notion.BlockID(pageID) {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *cacheClient) blockPath(id notion.BlockID) string {
+	return filepath.Join(c.dir, string(id)+".json")
+}
+
+// load reads a cached block from disk, once per run; c.mu must be held.
+func (c *cacheClient) load(id notion.BlockID) *cachedBlock {
+	if b, ok := c.blocks[id]; ok {
+		return b
+	}
+	var b *cachedBlock
+	if !Refresh && !isPlanned(id) {
+		// a missing or unreadable cache is a miss
+		b, _ = loadCachedBlock(c.blockPath(id))
+	}
+	c.blocks[id] = b
+	return b
+}
+
+func (c *cacheClient) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.dirty) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+	for id := range c.dirty {
+		if data, err := json.Marshal(c.blocks[id]); err != nil {
+			return err
+		} else if err := os.WriteFile(c.blockPath(id), data, 0600); err != nil {
+			return err
+		}
+	}
+	c.dirty = map[notion.BlockID]bool{}
+	return nil
+}
+
+// invalidate drops what is cached of the blocks seen in this run after a
+// change went through: the page they are on has changed.
+func (c *cacheClient) invalidate() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, b := range c.blocks {
+		if b == nil {
+			continue
+		}
+		if err := os.Remove(c.blockPath(id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	c.blocks = map[notion.BlockID]*cachedBlock{}
+	c.dirty = map[notion.BlockID]bool{}
+	c.pageObject = nil
+	return nil
+}
+
+// pageEdited is the current last_edited_time of a page, fetched once per
+// run; it is not known for blocks on no page seen so far, nor offline.
+func (c *cacheClient) pageEdited(ctx context.Context, page notion.BlockID) (time.Time, bool) {
+	c.mu.Lock()
+	edited, ok := c.edited[page]
+	offline := c.offline
+	c.mu.Unlock()
+	if ok || page == "" || offline {
+		return edited, ok
+	}
+	p, err := c.NotionAPI.GetPage(ctx, notion.PageID(page))
+	if err != nil {
+		if unreachable(err) {
+			c.goOffline()
+		}
+		return time.Time{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.edited[page] = p.LastEditedTime
+	return p.LastEditedTime, true
+}
+
+// track notes the page each of the blocks is on; c.mu must be held.
+func (c *cacheClient) track(page notion.BlockID, response *notion.GetChildrenResponse) {
+	for _, b := range response.Results {
+		if b.GetType() == notion.BlockTypeChildPage {
+			c.page[b.GetID()] = b.GetID()
+		} else {
+			c.page[b.GetID()] = page
+		}
+	}
+}
+
+func (c *cacheClient) GetPage(ctx context.Context, id notion.PageID) (*notion.Page, error) {
+	if id == c.pageID {
+		c.mu.Lock()
+		page := c.pageObject
+		c.mu.Unlock()
+		if page != nil {
+			return page, nil
+		}
+	}
+	if c.isOffline() {
+		return nil, fmt.Errorf("page %s: %w", id, ErrNotCached)
+	}
+	page, err := c.NotionAPI.GetPage(ctx, id)
+	if err == nil && id == c.pageID {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.pageObject = page
+	}
+	return page, err
+}
+
+func (c *cacheClient) GetBlockChildren(ctx context.Context, id notion.BlockID, pagination *notion.Pagination) (*notion.GetChildrenResponse, error) {
+	if isPending(id) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.journal.Overlay(id, &notion.GetChildrenResponse{Object: notion.ObjectTypeList}), nil
+	}
+	cursor := ""
+	if pagination != nil {
+		cursor = string(pagination.StartCursor)
+	}
+	c.mu.Lock()
+	page := c.page[id]
+	cached := c.load(id)
+	c.mu.Unlock()
+	edited, known := c.pageEdited(ctx, page)
+	c.mu.Lock()
+	if cached != nil && cached.Children[cursor] != nil && (c.offline || (known && cached.valid(page, edited))) {
+		defer c.mu.Unlock()
+		c.track(page, cached.Children[cursor])
+		return c.journal.Overlay(id, cached.Children[cursor]), nil
+	} else if c.offline {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("children of %s: %w", id, ErrNotCached)
+	}
+	c.mu.Unlock()
+	response, err := c.NotionAPI.GetBlockChildren(ctx, id, pagination)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if known && !isPlanned(id) {
+		// an outdated block is replaced, not merged with the new batches
+		entry := c.blocks[id]
+		if entry == nil || !c.dirty[id] {
+			entry = &cachedBlock{Page: page, Edited: edited, CachedAt: time.Now(), Children: map[string]*notion.GetChildrenResponse{}}
+			if id == notion.BlockID(c.pageID) {
+				entry.PageObject = c.pageObject
+			}
+			c.blocks[id] = entry
+		}
+		entry.Children[cursor] = response
+		c.dirty[id] = true
+	}
+	c.track(page, response)
+	return c.journal.Overlay(id, response), nil
+}
+
+// cached finds the last seen state of a block, offline additions included.
+func (c *cacheClient) cached(id notion.BlockID) notion.Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for parent, b := range c.blocks {
+		if b == nil {
+			continue
+		}
+		for _, response := range b.Children {
+			for _, block := range c.journal.Overlay(parent, response).Results {
+				if block.GetID() == id {
+					return block
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// queue journals a change for `nogo sync` instead of sending it.
+func (c *cacheClient) queue(entry JournalEntry) error {
+	if b := c.cached(entry.BlockID); b != nil && entry.Op != OpAppend {
+		entry.Text = RichText2Plain(BlockRichText(b))
+		entry.LastEditedTime = b.GetLastEditedTime()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.PageID = string(c.pageID)
+	if err := c.journal.Add(entry); err != nil {
+		return err
+	}
+	if !c.notified {
+		c.notified = true
+		fmt.Printf("%soffline: changes are queued until `nogo sync`%s\n", utils.HiDim, utils.HiReset)
+	}
+	return nil
+}
+
+// sent drops the cached blocks after a change went through; it reports
+// whether the change has to be queued instead.
+func (c *cacheClient) sent(err error) (bool, error) {
+	if err == nil {
+		return false, c.invalidate()
+	} else if unreachable(err) {
+		c.goOffline()
+		return true, nil
+	}
+	return false, err
+}
+
+func (c *cacheClient) AppendBlockChildren(ctx context.Context, id notion.BlockID, request *notion.AppendBlockChildrenRequest) (*notion.AppendBlockChildrenResponse, error) {
+	if !c.isOffline() && !isPending(id) {
+		response, err := c.NotionAPI.AppendBlockChildren(ctx, id, request)
+		if queue, err := c.sent(err); !queue {
+			return response, err
+		}
+	}
+	children := PendingBlocks(request.Children)
+	if err := c.queue(JournalEntry{Op: OpAppend, BlockID: id, After: request.After, Children: children}); err != nil {
+		return nil, err
+	}
+	return &notion.AppendBlockChildrenResponse{Object: notion.ObjectTypeList, Results: children}, nil
+}
+
+func (c *cacheClient) UpdateBlock(ctx context.Context, id notion.BlockID, request *notion.BlockUpdateRequest) (notion.Block, error) {
+	if !c.isOffline() && !isPending(id) {
+		block, err := c.NotionAPI.UpdateBlock(ctx, id, request)
+		if queue, err := c.sent(err); !queue {
+			return block, err
+		}
+	}
+	if err := c.queue(JournalEntry{Op: OpUpdate, BlockID: id, Update: request}); err != nil {
+		return nil, err
+	}
+	return c.cached(id), nil
+}
+
+func (c *cacheClient) DeleteBlock(ctx context.Context, id notion.BlockID) (notion.Block, error) {
+	if !c.isOffline() && !isPending(id) {
+		block, err := c.NotionAPI.DeleteBlock(ctx, id)
+		if queue, err := c.sent(err); !queue {
+			return block, err
+		}
+	}
+	block := c.cached(id)
+	if err := c.queue(JournalEntry{Op: OpDelete, BlockID: id}); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (c *cacheClient) RestoreBlock(ctx context.Context, id notion.BlockID) (notion.Block, error) {
+	if c.isOffline() {
+		return nil, errOfflineEdit
+	}
+	if block, err := c.NotionAPI.RestoreBlock(ctx, id); err != nil {
+		return nil, err
+	} else {
+		return block, c.invalidate()
+	}
+}
+
+func (c *cacheClient) CreatePage(ctx context.Context, request *notion.PageCreateRequest) (*notion.Page, error) {
+	if c.isOffline() {
+		return nil, errOfflineEdit
+	}
+	if page, err := c.NotionAPI.CreatePage(ctx, request); err != nil {
+		return nil, err
+	} else {
+		return page, c.invalidate()
+	}
+}
+
+func (c *cacheClient) GetBlock(ctx context.Context, id notion.BlockID) (notion.Block, error) {
+	if c.isOffline() {
+		return nil, fmt.Errorf("block %s: %w", id, ErrNotCached)
+	}
+	return c.NotionAPI.GetBlock(ctx, id)
+}
+
+func (c *cacheClient) GetDatabase(ctx context.Context, id notion.DatabaseID) (*notion.Database, error) {
+	if c.isOffline() {
+		return nil, fmt.Errorf("database %s: %w", id, ErrNotCached)
+	}
+	return c.NotionAPI.GetDatabase(ctx, id)
+}
+
+func (c *cacheClient) QueryDatabase(ctx context.Context, id notion.DatabaseID, request *notion.DatabaseQueryRequest) (*notion.DatabaseQueryResponse, error) {
+	if c.isOffline() {
+		return nil, fmt.Errorf("database %s: %w", id, ErrNotCached)
+	}
+	return c.NotionAPI.QueryDatabase(ctx, id, request)
+}
+
+func (c *cacheClient) Search(ctx context.Context, request *notion.SearchRequest) (*notion.SearchResponse, error) {
+	if c.isOffline() {
+		return nil, fmt.Errorf("search: %w", ErrNotCached)
+	}
+	return c.NotionAPI.Search(ctx, request)
+}
+
+func (c *cacheClient) GetUser(ctx context.Context, id notion.UserID) (*notion.User, error) {
+	if c.isOffline() {
+		return nil, fmt.Errorf("user %s: %w", id, ErrNotCached)
+	}
+	return c.NotionAPI.GetUser(ctx, id)
+}
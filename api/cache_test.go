@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// cachedFake is a fake notion whose edits are an hour old, so that what is
+// cached from it is not within editGranularity of them.
+func cachedFake(t *testing.T) *FakeNotion {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	f := NewFakeNotion(t)
+	f.Now = func() time.Time { return time.Now().Add(-time.Hour) }
+	return f
+}
+
+// fetches runs a command through a new cache client, as a new `nogo` would,
+// and counts the pages of children it fetched from notion.
+func fetches(t *testing.T, f NotionAPI, pageID string, run func(client NotionAPI)) int {
+	t.Helper()
+	counter := &countingClient{NotionAPI: f}
+	if client, err := NewCacheClient(counter, pageID); err != nil {
+		t.Fatal(err)
+	} else {
+		run(client)
+	}
+	if err := SaveCache(); err != nil {
+		t.Fatal(err)
+	}
+	return counter.pages
+}
+
+func stackID(f *FakeNotion, pageID string) notion.BlockID {
+	return f.Children(notion.BlockID(pageID))[0].GetID()
+}
+
+func TestCacheReusesUnchangedPage(t *testing.T) {
+	f := cachedFake(t)
+	pageID := newStackIn(f, todo("buy milk", false, todo("oat", false)), todo("call bob", false))
+	want := []string{"[ ] buy milk", "  [ ] oat", "[ ] call bob"}
+	var got []string
+	if n := fetches(t, f, pageID, func(client NotionAPI) { got = stackState(t, client, pageID) }); n != 3 {
+		t.Errorf("first run fetched %d pages of children, want 3", n)
+	}
+	if n := fetches(t, f, pageID, func(client NotionAPI) { got = stackState(t, client, pageID) }); n != 0 {
+		t.Errorf("unchanged page fetched %d pages of children, want none", n)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got cached stack %q, want %q", got, want)
+	}
+
+	defer func(refresh bool) { Refresh = refresh }(Refresh)
+	Refresh = true
+	if n := fetches(t, f, pageID, func(client NotionAPI) { stackState(t, client, pageID) }); n != 3 {
+		t.Errorf("--refresh fetched %d pages of children, want 3", n)
+	}
+}
+
+func TestCacheRefetchesEditedPage(t *testing.T) {
+	f := cachedFake(t)
+	pageID := newStackIn(f, todo("buy milk", false), todo("call bob", false))
+	fetches(t, f, pageID, func(client NotionAPI) { stackState(t, client, pageID) })
+
+	entry := f.Children(stackID(f, pageID))[0]
+	f.Now = time.Now
+	if _, err := f.UpdateBlock(context.Background(), entry.GetID(), &notion.BlockUpdateRequest{ToDo: &todo("buy oat milk", false).ToDo}); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	if n := fetches(t, f, pageID, func(client NotionAPI) { got = stackState(t, client, pageID) }); n != 2 {
+		t.Errorf("edited page fetched %d pages of children, want 2", n)
+	}
+	if want := []string{"[ ] buy oat milk", "[ ] call bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got stack %q, want %q", got, want)
+	}
+}
+
+func TestCacheValidatesSubpages(t *testing.T) {
+	f := cachedFake(t)
+	page := f.AddPage("", "Notes", "")
+	f.AddBlocks(notion.BlockID(page), paragraph("top"))
+	sub := f.AddPage(page, "Sub", "")
+	text := f.AddBlocks(notion.BlockID(sub), paragraph("old"))[0]
+	var got []string
+	read := func(client NotionAPI) {
+		got = nil
+		for _, id := range []notion.BlockID{notion.BlockID(page), notion.BlockID(sub)} {
+			if blocks, err := GetChildren(client, id); err != nil {
+				t.Fatal(err)
+			} else {
+				for _, b := range blocks {
+					got = append(got, planLine(b))
+				}
+			}
+		}
+	}
+	fetches(t, f, string(page), read)
+
+	// notion does not bump the page for edits inside its sub-pages
+	if _, err := f.UpdateBlock(context.Background(), text, &notion.BlockUpdateRequest{Paragraph: &paragraph("new").Paragraph}); err != nil {
+		t.Fatal(err)
+	}
+	if n := fetches(t, f, string(page), read); n != 1 {
+		t.Errorf("fetched %d pages of children, want only the sub-page's", n)
+	}
+	if want := []string{"paragraph: top", "page: Sub", "paragraph: new"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCacheSavedOncePerCommand(t *testing.T) {
+	f := cachedFake(t)
+	pageID := newStackIn(f, todo("buy milk", false, todo("oat", false)))
+	client, err := NewCacheClient(f, pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stackState(t, client, pageID)
+	dir, err := blockCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) > 0 {
+		t.Errorf("%d blocks written before the command was done", len(files))
+	}
+	if err := SaveCache(); err != nil {
+		t.Fatal(err)
+	}
+	stack := stackID(f, pageID)
+	want := []string{pageID, string(stack), string(f.Children(stack)[0].GetID())}
+	got := []string{}
+	files, _ := os.ReadDir(dir)
+	for _, file := range files {
+		got = append(got, file.Name())
+	}
+	for i := range want {
+		want[i] += ".json"
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cached %q, want one file per block: %q", got, want)
+	}
+}
+
+func TestCacheAfterWrite(t *testing.T) {
+	f := cachedFake(t)
+	pageID := newStackIn(f, todo("buy milk", false))
+	fetches(t, f, pageID, func(client NotionAPI) {
+		stackState(t, client, pageID)
+		if err := AddToStack(client, pageID, "call bob", nil); err != nil {
+			t.Fatal(err)
+		}
+		checkStack(t, client, pageID, "[ ] buy milk", "[ ] call bob")
+	})
+	var got []string
+	if n := fetches(t, f, pageID, func(client NotionAPI) { got = stackState(t, client, pageID) }); n == 0 {
+		t.Error("the page changed by the last command was served from the cache")
+	}
+	if want := []string{"[ ] buy milk", "[ ] call bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got stack %q, want %q", got, want)
+	}
+	dir, _ := blockCacheDir()
+	if _, err := os.Stat(filepath.Join(dir, pageID+".json")); err != nil {
+		t.Errorf("page not cached again after the change: %v", err)
+	}
+}
+
+func TestDropCache(t *testing.T) {
+	f := cachedFake(t)
+	pageID := newStackIn(f, todo("buy milk", false))
+	other := newStackIn(f, todo("call bob", false))
+	fetches(t, f, pageID, func(client NotionAPI) { stackState(t, client, pageID) })
+	fetches(t, f, other, func(client NotionAPI) { stackState(t, client, other) })
+	if err := DropCache(pageID); err != nil {
+		t.Fatal(err)
+	}
+	if n := fetches(t, f, pageID, func(client NotionAPI) { stackState(t, client, pageID) }); n != 2 {
+		t.Errorf("dropped page fetched %d pages of children, want 2", n)
+	}
+	if n := fetches(t, f, other, func(client NotionAPI) { stackState(t, client, other) }); n != 0 {
+		t.Errorf("other page fetched %d pages of children, want none", n)
+	}
+}
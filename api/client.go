@@ -0,0 +1,247 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	notion "github.com/jomei/notionapi"
+)
+
+type NotionAPI interface {
+	GetBlock(context.Context, notion.BlockID) (notion.Block, error)
+	GetBlockChildren(context.Context, notion.BlockID, *notion.Pagination) (*notion.GetChildrenResponse, error)
+	AppendBlockChildren(context.Context, notion.BlockID, *notion.AppendBlockChildrenRequest) (*notion.AppendBlockChildrenResponse, error)
+	UpdateBlock(context.Context, notion.BlockID, *notion.BlockUpdateRequest) (notion.Block, error)
+	DeleteBlock(context.Context, notion.BlockID) (notion.Block, error)
+	// RestoreBlock takes a deleted (archived) block out of the trash.
+	RestoreBlock(context.Context, notion.BlockID) (notion.Block, error)
+	GetPage(context.Context, notion.PageID) (*notion.Page, error)
+	CreatePage(context.Context, *notion.PageCreateRequest) (*notion.Page, error)
+	GetDatabase(context.Context, notion.DatabaseID) (*notion.Database, error)
+	QueryDatabase(context.Context, notion.DatabaseID, *notion.DatabaseQueryRequest) (*notion.DatabaseQueryResponse, error)
+	Search(context.Context, *notion.SearchRequest) (*notion.SearchResponse, error)
+	GetUser(context.Context, notion.UserID) (*notion.User, error)
+}
+
+// what notionapi cannot send (restoring a block, searching without a filter,
+// all-day dates) is a hand-made request against these.
+const (
+	notionURL     = "https://api.notion.com/v1"
+	notionVersion = "2022-06-28"
+)
+
+type notionClient struct {
+	client *notion.Client
+	http   *http.Client
+	// timeout of each call (see --timeout), zero for none
+	timeout time.Duration
+}
+
+// context bounds a single call, counted from when it is made: time spent in
+// prompts between calls does not count.
+func (c *notionClient) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+func (c *notionClient) GetBlock(ctx context.Context, id notion.BlockID) (notion.Block, error) {
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	return c.client.Block.Get(ctx, id)
+}
+
+func (c *notionClient) GetBlockChildren(ctx context.Context, id notion.BlockID, pagination *notion.Pagination) (*notion.GetChildrenResponse, error) {
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	return c.client.Block.GetChildren(ctx, id, pagination)
+}
+
+func (c *notionClient) AppendBlockChildren(ctx context.Context, id notion.BlockID, request *notion.AppendBlockChildrenRequest) (*notion.AppendBlockChildrenResponse, error) {
+	if body, ok, err := withAllDayDates(request); err != nil {
+		return nil, err
+	} else if ok {
+		response := &notion.AppendBlockChildrenResponse{}
+		if data, err := c.raw(ctx, http.MethodPatch, "/blocks/"+string(id)+"/children", body); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(data, response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	return c.client.Block.AppendChildren(ctx, id, request)
+}
+
+func (c *notionClient) UpdateBlock(ctx context.Context, id notion.BlockID, request *notion.BlockUpdateRequest) (notion.Block, error) {
+	if body, ok, err := withAllDayDates(request); err != nil {
+		return nil, err
+	} else if ok {
+		if data, err := c.raw(ctx, http.MethodPatch, "/blocks/"+string(id), body); err != nil {
+			return nil, err
+		} else {
+			return decodeBlock(data)
+		}
+	}
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	return c.client.Block.Update(ctx, id, request)
+}
+
+func (c *notionClient) DeleteBlock(ctx context.Context, id notion.BlockID) (notion.Block, error) {
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	return c.client.Block.Delete(ctx, id)
+}
+
+// raw sends a request notionapi cannot express and returns the response body.
+func (c *notionClient) raw(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, notionURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.client.Token.String())
+	req.Header.Set("Notion-Version", notionVersion)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		apiErr := &notion.Error{}
+		if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Message == "" {
+			return nil, fmt.Errorf("%s %s: %s", method, path, res.Status)
+		}
+		return nil, apiErr
+	}
+	return data, nil
+}
+
+func (c *notionClient) RestoreBlock(ctx context.Context, id notion.BlockID) (notion.Block, error) {
+	if data, err := c.raw(ctx, http.MethodPatch, "/blocks/"+string(id), map[string]bool{"archived": false}); err != nil {
+		return nil, err
+	} else {
+		return decodeBlock(data)
+	}
+}
+
+// withAllDayDates re-encodes a request with its all-day date mentions (see
+// isDateOnly) as plain dates: notionapi sends every date with a time, which
+// notion would keep as a mention of midnight UTC rather than of the day. It
+// reports whether any date was rewritten; if not, the request can go through
+// notionapi as is.
+func withAllDayDates(request interface{}) (interface{}, bool, error) {
+	var body interface{}
+	if data, err := json.Marshal(request); err != nil {
+		return nil, false, err
+	} else if err := json.Unmarshal(data, &body); err != nil {
+		return nil, false, err
+	}
+	return body, rewriteAllDayDates(body), nil
+}
+
+func rewriteAllDayDates(v interface{}) bool {
+	rewritten := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if mention, ok := v["mention"].(map[string]interface{}); ok {
+			if date, ok := mention["date"].(map[string]interface{}); ok {
+				for _, key := range []string{"start", "end"} {
+					if s, ok := date[key].(string); ok {
+						if t, err := time.Parse(time.RFC3339, s); err == nil && isDateOnly(t) {
+							date[key] = t.Format("2006-01-02")
+							rewritten = true
+						}
+					}
+				}
+			}
+		}
+		for _, child := range v {
+			rewritten = rewriteAllDayDates(child) || rewritten
+		}
+	case []interface{}:
+		for _, child := range v {
+			rewritten = rewriteAllDayDates(child) || rewritten
+		}
+	}
+	return rewritten
+}
+
+// decodeBlock reads a single block as returned by notion.
+func decodeBlock(data []byte) (notion.Block, error) {
+	var blocks notion.Blocks
+	if err := json.Unmarshal([]byte("["+string(data)+"]"), &blocks); err != nil {
+		return nil, err
+	}
+	return blocks[0], nil
+}
+
+func (c *notionClient) GetPage(ctx context.Context, id notion.PageID) (*notion.Page, error) {
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	return c.client.Page.Get(ctx, id)
+}
+
+func (c *notionClient) CreatePage(ctx context.Context, request *notion.PageCreateRequest) (*notion.Page, error) {
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	return c.client.Page.Create(ctx, request)
+}
+
+func (c *notionClient) GetDatabase(ctx context.Context, id notion.DatabaseID) (*notion.Database, error) {
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	return c.client.Database.Get(ctx, id)
+}
+
+func (c *notionClient) QueryDatabase(ctx context.Context, id notion.DatabaseID, request *notion.DatabaseQueryRequest) (*notion.DatabaseQueryResponse, error) {
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	return c.client.Database.Query(ctx, id, request)
+}
+
+func (c *notionClient) Search(ctx context.Context, request *notion.SearchRequest) (*notion.SearchResponse, error) {
+	if request.Filter.Value == "" {
+		// notionapi always sends the filter, which notion rejects when empty
+		unfiltered := struct {
+			Query       string             `json:"query,omitempty"`
+			Sort        *notion.SortObject `json:"sort,omitempty"`
+			StartCursor notion.Cursor      `json:"start_cursor,omitempty"`
+			PageSize    int                `json:"page_size,omitempty"`
+		}{request.Query, request.Sort, request.StartCursor, request.PageSize}
+		response := &notion.SearchResponse{}
+		if data, err := c.raw(ctx, http.MethodPost, "/search", unfiltered); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(data, response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	return c.client.Search.Do(ctx, request)
+}
+
+func (c *notionClient) GetUser(ctx context.Context, id notion.UserID) (*notion.User, error) {
+	ctx, cancel := c.context(ctx)
+	defer cancel()
+	return c.client.User.Get(ctx, id)
+}
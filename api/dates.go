@@ -0,0 +1,155 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// Now is the clock due dates are resolved and checked against; swap it to get
+// deterministic results.
+var Now = time.Now
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+var (
+	relativePattern = regexp.MustCompile(`^in (a|an|\d+) (hour|day|week|month)s?$`)
+	// a time of day, after an optional day (`friday at 9am`, `12pm`)
+	timeOfDayPattern = regexp.MustCompile(`^(?:(.*?)\s+)??(?:at\s+)?(\d{1,2})(?::(\d{2}))?\s*(am|pm)?$`)
+)
+
+// dateOnly is a calendar day the way notion returns it: midnight UTC.
+func dateOnly(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func endOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 23, 59, 0, 0, t.Location())
+}
+
+func daysUntil(from time.Time, day time.Weekday) int {
+	return (int(day) - int(from.Weekday()) + 7) % 7
+}
+
+// nextWeek is the monday of the coming week.
+func nextWeek(now time.Time) time.Time {
+	return now.AddDate(0, 0, daysUntil(now.AddDate(0, 0, 1), time.Monday)+1)
+}
+
+// parseDay resolves a day relative to now (in now's time zone); hasTime
+// reports whether it already carries a time of day.
+func parseDay(s string, now time.Time) (t time.Time, hasTime bool, ok bool) {
+	switch s {
+	case "today":
+		return now, false, true
+	case "tomorrow", "tmr":
+		return now.AddDate(0, 0, 1), false, true
+	case "day after tomorrow":
+		return now.AddDate(0, 0, 2), false, true
+	case "eod", "end of day", "tonight":
+		return endOfDay(now), true, true
+	case "eow", "end of week":
+		return endOfDay(now.AddDate(0, 0, daysUntil(now, time.Sunday))), true, true
+	case "next week":
+		return nextWeek(now), false, true
+	case "next month":
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location()), false, true
+	}
+	if day, found := weekdays[strings.TrimPrefix(s, "this ")]; found {
+		return now.AddDate(0, 0, daysUntil(now, day)), false, true
+	}
+	if day, found := weekdays[strings.TrimPrefix(s, "next ")]; found && strings.HasPrefix(s, "next ") {
+		monday := nextWeek(now)
+		return monday.AddDate(0, 0, daysUntil(monday, day)), false, true
+	}
+	if m := relativePattern.FindStringSubmatch(s); m != nil {
+		n := 1
+		if m[1] != "a" && m[1] != "an" {
+			n, _ = strconv.Atoi(m[1])
+		}
+		switch m[2] {
+		case "hour":
+			return now.Add(time.Duration(n) * time.Hour).Truncate(time.Minute), true, true
+		case "day":
+			return now.AddDate(0, 0, n), false, true
+		case "week":
+			return now.AddDate(0, 0, 7*n), false, true
+		case "month":
+			return now.AddDate(0, n, 0), false, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// ParseNaturalDate reads a due date relative to now: besides the formats of
+// ParseDue it understands
+//
+//	today, tomorrow, day after tomorrow
+//	eod (today 23:59), eow (sunday 23:59)
+//	friday, this friday (today or the coming one)
+//	next week (monday), next friday (the friday of next week)
+//	next month (the 1st)
+//	in 3 days, in a week, in 2 months, in 4 hours
+//
+// optionally followed by a time of day (`tomorrow 9am`, `friday at 14:30`);
+// a time alone (`9am`, `at 14:30`) is today. Days without a time are all-day
+// dates, stored the way notion returns them (midnight UTC of the local
+// calendar day, like `@due(2026-11-01)`); times are in now's time zone.
+func ParseNaturalDate(s string, now time.Time) (*notion.Date, error) {
+	if date, err := parseDueIn(s, now.Location()); err == nil {
+		return date, nil
+	}
+	s = strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	if t, hasTime, ok := parseDay(s, now); ok {
+		if !hasTime {
+			t = dateOnly(t)
+		}
+		date := notion.Date(t)
+		return &date, nil
+	}
+	if m := timeOfDayPattern.FindStringSubmatch(s); m != nil && (m[1] != "" || m[3] != "" || m[4] != "") {
+		day := m[1]
+		if day == "" {
+			day = "today"
+		}
+		if t, hasTime, ok := parseDay(day, now); ok && !hasTime {
+			if hour, minute, ok := parseTimeOfDay(m[2], m[3], m[4]); ok {
+				y, mo, d := t.Date()
+				date := notion.Date(time.Date(y, mo, d, hour, minute, 0, 0, now.Location()))
+				return &date, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("cannot parse due date `%s` (e.g. 2026-11-01, tomorrow, next friday 9am, in 3 days, eod)", s)
+}
+
+// parseTimeOfDay reads `14`, `14:30`, `9am` or `9:30pm`.
+func parseTimeOfDay(hours, minutes, meridiem string) (int, int, bool) {
+	hour, _ := strconv.Atoi(hours)
+	minute, _ := strconv.Atoi(minutes)
+	if minute > 59 {
+		return 0, 0, false
+	}
+	switch meridiem {
+	case "":
+		return hour, minute, hour <= 23
+	case "am":
+		return hour % 12, minute, hour >= 1 && hour <= 12
+	default:
+		return hour%12 + 12, minute, hour >= 1 && hour <= 12
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// formatDue shows an all-day date as YYYY-MM-DD and a time with its offset.
+func formatDue(t time.Time) string {
+	if isDateOnly(t) {
+		return t.UTC().Format("2006-01-02")
+	}
+	return t.Format("2006-01-02T15:04Z07:00")
+}
+
+func TestParseNaturalDate(t *testing.T) {
+	zone := time.FixedZone("PDT", -7*60*60)
+	// a Thursday
+	thursday := time.Date(2026, 10, 15, 10, 0, 0, 0, zone)
+	// late enough to be Friday in UTC already
+	lateThursday := time.Date(2026, 10, 15, 23, 30, 0, 0, zone)
+	sunday := time.Date(2026, 10, 18, 10, 0, 0, 0, zone)
+	tests := []struct {
+		in   string
+		now  time.Time
+		want string
+	}{
+		{"2026-11-01", thursday, "2026-11-01"},
+		{"2026-11-01T18:00", thursday, "2026-11-01T18:00-07:00"},
+		{"today", thursday, "2026-10-15"},
+		{"tomorrow", thursday, "2026-10-16"},
+		{"tmr", thursday, "2026-10-16"},
+		{"day after tomorrow", thursday, "2026-10-17"},
+		{"  Day   After TOMORROW ", thursday, "2026-10-17"},
+		{"eod", thursday, "2026-10-15T23:59-07:00"},
+		{"tonight", thursday, "2026-10-15T23:59-07:00"},
+		{"eow", thursday, "2026-10-18T23:59-07:00"},
+		{"eow", sunday, "2026-10-18T23:59-07:00"},
+		{"thursday", thursday, "2026-10-15"},
+		{"friday", thursday, "2026-10-16"},
+		{"this friday", thursday, "2026-10-16"},
+		{"fri", thursday, "2026-10-16"},
+		{"wednesday", thursday, "2026-10-21"},
+		{"next friday", thursday, "2026-10-23"},
+		{"next thursday", thursday, "2026-10-22"},
+		{"next monday", thursday, "2026-10-19"},
+		{"next week", thursday, "2026-10-19"},
+		{"next week", sunday, "2026-10-19"},
+		// on a Sunday the coming friday already is in next week
+		{"friday", sunday, "2026-10-23"},
+		{"next friday", sunday, "2026-10-23"},
+		{"next sunday", sunday, "2026-10-25"},
+		{"next month", thursday, "2026-11-01"},
+		{"in 3 days", thursday, "2026-10-18"},
+		{"in a week", thursday, "2026-10-22"},
+		{"in 2 weeks", thursday, "2026-10-29"},
+		{"in 2 months", thursday, "2026-12-15"},
+		{"in 4 hours", thursday, "2026-10-15T14:00-07:00"},
+		{"in an hour", thursday, "2026-10-15T11:00-07:00"},
+		{"tomorrow 9am", thursday, "2026-10-16T09:00-07:00"},
+		{"tomorrow at 9:30pm", thursday, "2026-10-16T21:30-07:00"},
+		{"friday at 14:30", thursday, "2026-10-16T14:30-07:00"},
+		{"next friday 9am", thursday, "2026-10-23T09:00-07:00"},
+		// midnight UTC, but a time rather than an all-day date
+		{"day after tomorrow 17", thursday, "2026-10-17T17:00-07:00"},
+		{"9am", thursday, "2026-10-15T09:00-07:00"},
+		{"12pm", thursday, "2026-10-15T12:00-07:00"},
+		{"12am", thursday, "2026-10-15T00:00-07:00"},
+		{"at 14:30", thursday, "2026-10-15T14:30-07:00"},
+		// days are the local calendar day, whatever the date is in UTC
+		{"today", lateThursday, "2026-10-15"},
+		{"tomorrow", lateThursday, "2026-10-16"},
+		{"eod", lateThursday, "2026-10-15T23:59-07:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in+"@"+tt.now.Format("Mon15:04"), func(t *testing.T) {
+			if got, err := ParseNaturalDate(tt.in, tt.now); err != nil {
+				t.Fatal(err)
+			} else if formatDue(time.Time(*got)) != tt.want {
+				t.Errorf("got %s, want %s", formatDue(time.Time(*got)), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNaturalDateErrors(t *testing.T) {
+	now := time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC)
+	for _, in := range []string{
+		"",
+		"someday",
+		"next",
+		"in some days",
+		// a bare number is not a time
+		"14",
+		"13pm",
+		"0am",
+		"tomorrow 25",
+		"tomorrow 9:75",
+		// eod already has a time
+		"eod 9am",
+		"2026-13-01",
+	} {
+		if got, err := ParseNaturalDate(in, now); err == nil {
+			t.Errorf("%q: got %s, want an error", in, formatDue(time.Time(*got)))
+		}
+	}
+}
+
+func TestInlineDueUsesNow(t *testing.T) {
+	defer func(now func() time.Time) { Now = now }(Now)
+	Now = func() time.Time { return time.Date(2026, 10, 15, 10, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		entry   string
+		due     string
+		overdue bool
+	}{
+		{"call bob @due(tomorrow)", "2026-10-16", false},
+		{"call bob @due(today)", "2026-10-15", false},
+		{"pay rent @due(2026-10-14)", "2026-10-14", true},
+		{"pay rent @due(eod)", "2026-10-15T23:59Z", false},
+	}
+	for _, tt := range tests {
+		rts, err := EntryRichText(tt.entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta := ParseEntryMeta(rts)
+		if meta.Due == nil {
+			t.Fatalf("%q: no due date", tt.entry)
+		}
+		if got := formatDue(*meta.Due); got != tt.due {
+			t.Errorf("%q: due %s, want %s", tt.entry, got, tt.due)
+		}
+		if got := meta.Overdue(Now()); got != tt.overdue {
+			t.Errorf("%q: overdue %v, want %v", tt.entry, got, tt.overdue)
+		}
+	}
+}
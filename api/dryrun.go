@@ -0,0 +1,309 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haykh/nogo/utils"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// DryRun reads from notion as usual but only prints the changes commands
+// would make.
+var DryRun bool
+
+// dryRunPrefix marks the ids of blocks and pages that were only planned.
+const dryRunPrefix = "dry-run-"
+
+// planned collects the changes of the running command until ShowPlan.
+var planned struct {
+	sync.Mutex
+	lines []string
+}
+
+func plan(sign string, color utils.ColorType, depth int, line string) {
+	planned.Lock()
+	defer planned.Unlock()
+	planned.lines = append(planned.lines, fmt.Sprintf("%s%s %s%s%s", color, sign, strings.Repeat("  ", depth), line, utils.ColorReset))
+}
+
+// writeConfig makes a change to the local config, or only plans it in a dry
+// run.
+func writeConfig(change string, write func() error) error {
+	if DryRun {
+		plan("~", utils.ColorYellow, 0, "config: "+change)
+		return nil
+	}
+	return write()
+}
+
+// ShowPlan prints the changes collected in a dry run, in order; it prints
+// nothing for commands that planned none (e.g. the ones only reading).
+func ShowPlan() {
+	planned.Lock()
+	defer planned.Unlock()
+	if len(planned.lines) == 0 {
+		return
+	}
+	fmt.Printf("%sdry run, nothing was sent to notion:%s\n", utils.HiDim, utils.HiReset)
+	for _, line := range planned.lines {
+		fmt.Println(line)
+	}
+	planned.lines = nil
+}
+
+// planLine describes a block the way a stack shows it: to-dos with their
+// checkbox, anything else with its type.
+func planLine(b notion.Block) string {
+	switch b := b.(type) {
+	case *notion.ToDoBlock:
+		box := "[ ]"
+		if b.ToDo.Checked {
+			box = "[x]"
+		}
+		return box + " " + RichText2Plain(b.ToDo.RichText)
+	case *notion.ChildPageBlock:
+		return "page: " + b.ChildPage.Title
+	default:
+		return fmt.Sprintf("%s: %s", b.GetType(), RichText2Plain(BlockRichText(b)))
+	}
+}
+
+// dryRunClient answers reads from notion and plans writes instead of sending
+// them. Planned blocks get placeholder ids and can be read back, so commands
+// building on their own changes (e.g. archive creating the Done page) run to
+// the end.
+type dryRunClient struct {
+	NotionAPI
+	mu     sync.Mutex
+	lastID int
+	// seen holds the last known state of blocks, planned ones included.
+	seen map[notion.BlockID]notion.Block
+	// depth of planned blocks, to indent what is planned under them
+	depth    map[notion.BlockID]int
+	children map[notion.BlockID]notion.Blocks
+}
+
+func withDryRun(client NotionAPI) NotionAPI {
+	if !DryRun {
+		return client
+	}
+	return &dryRunClient{
+		NotionAPI: client,
+		seen:      map[notion.BlockID]notion.Block{},
+		depth:     map[notion.BlockID]int{},
+		children:  map[notion.BlockID]notion.Blocks{},
+	}
+}
+
+func isPlanned(id notion.BlockID) bool {
+	return strings.HasPrefix(string(id), dryRunPrefix)
+}
+
+func (c *dryRunClient) newID() notion.BlockID {
+	c.lastID++
+	return notion.BlockID(fmt.Sprintf("%s%d", dryRunPrefix, c.lastID))
+}
+
+// block is the last known state of a block, fetched if it was never seen.
+func (c *dryRunClient) block(ctx context.Context, id notion.BlockID) (notion.Block, error) {
+	c.mu.Lock()
+	b, ok := c.seen[id]
+	c.mu.Unlock()
+	if ok {
+		return cloneBlock(b)
+	} else if isPlanned(id) {
+		return nil, fmt.Errorf("block %s not found", id)
+	}
+	return c.NotionAPI.GetBlock(ctx, id)
+}
+
+func (c *dryRunClient) GetBlock(ctx context.Context, id notion.BlockID) (notion.Block, error) {
+	if isPlanned(id) {
+		return c.block(ctx, id)
+	}
+	return c.NotionAPI.GetBlock(ctx, id)
+}
+
+func (c *dryRunClient) GetBlockChildren(ctx context.Context, id notion.BlockID, pagination *notion.Pagination) (*notion.GetChildrenResponse, error) {
+	if isPlanned(id) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		response := &notion.GetChildrenResponse{Object: notion.ObjectTypeList, Results: notion.Blocks{}}
+		for _, child := range c.children[id] {
+			if b := c.seen[child.GetID()]; !b.GetArchived() {
+				if clone, err := cloneBlock(b); err != nil {
+					return nil, err
+				} else {
+					response.Results = append(response.Results, clone)
+				}
+			}
+		}
+		return response, nil
+	}
+	response, err := c.NotionAPI.GetBlockChildren(ctx, id, pagination)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, b := range response.Results {
+		c.seen[b.GetID()] = b
+	}
+	return response, nil
+}
+
+// add plans blocks (with their nested children) under a parent.
+func (c *dryRunClient) add(parent notion.BlockID, after notion.BlockID, blocks notion.Blocks) notion.Blocks {
+	depth := 0
+	if d, ok := c.depth[parent]; ok {
+		depth = d + 1
+	}
+	note := ""
+	if b, ok := c.seen[after]; ok && after != "" {
+		note = fmt.Sprintf("  (after `%s`)", RichText2Plain(BlockRichText(b)))
+	}
+	created := notion.Blocks{}
+	for _, block := range blocks {
+		b, err := cloneBlock(block)
+		if err != nil {
+			continue
+		}
+		nested := takeChildren(b)
+		normalizeRichText(reflect.ValueOf(b))
+		now := time.Now()
+		basic := basicBlock(b)
+		basic.Object = notion.ObjectTypeBlock
+		basic.ID = c.newID()
+		basic.CreatedTime = &now
+		basic.LastEditedTime = &now
+		basic.Parent = &notion.Parent{Type: notion.ParentTypeBlockID, BlockID: parent}
+		c.seen[basic.ID] = b
+		c.depth[basic.ID] = depth
+		plan("+", utils.ColorGreen, depth, planLine(b)+note)
+		if len(nested) > 0 {
+			basic.HasChildren = true
+			c.add(basic.ID, "", nested)
+		}
+		created = append(created, b)
+	}
+	if isPlanned(parent) {
+		if p, ok := c.seen[parent]; ok {
+			basicBlock(p).HasChildren = true
+		}
+		c.children[parent] = append(c.children[parent], created...)
+	}
+	return created
+}
+
+func (c *dryRunClient) AppendBlockChildren(_ context.Context, id notion.BlockID, request *notion.AppendBlockChildrenRequest) (*notion.AppendBlockChildrenResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &notion.AppendBlockChildrenResponse{Object: notion.ObjectTypeList, Results: c.add(id, request.After, request.Children)}, nil
+}
+
+func (c *dryRunClient) UpdateBlock(ctx context.Context, id notion.BlockID, request *notion.BlockUpdateRequest) (notion.Block, error) {
+	before, err := c.block(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	after, err := cloneBlock(before)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyRequest(after, request); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen[id] = after
+	line := planLine(after)
+	if was := RichText2Plain(BlockRichText(before)); was != RichText2Plain(BlockRichText(after)) {
+		line += fmt.Sprintf("  (was `%s`)", was)
+	}
+	plan("~", utils.ColorYellow, c.depth[id], line)
+	return cloneBlock(after)
+}
+
+func (c *dryRunClient) DeleteBlock(ctx context.Context, id notion.BlockID) (notion.Block, error) {
+	b, err := c.block(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	basicBlock(b).Archived = true
+	c.seen[id] = b
+	plan("-", utils.ColorRed, c.depth[id], planLine(b))
+	return b, nil
+}
+
+func (c *dryRunClient) RestoreBlock(ctx context.Context, id notion.BlockID) (notion.Block, error) {
+	b, err := c.block(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	basicBlock(b).Archived = false
+	c.seen[id] = b
+	plan("+", utils.ColorGreen, c.depth[id], planLine(b)+"  (restored)")
+	return b, nil
+}
+
+func (c *dryRunClient) CreatePage(_ context.Context, request *notion.PageCreateRequest) (*notion.Page, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	id := c.newID()
+	page := &notion.Page{
+		Object:         notion.ObjectTypePage,
+		ID:             notion.ObjectID(id),
+		CreatedTime:    now,
+		LastEditedTime: now,
+		Parent:         request.Parent,
+		Icon:           request.Icon,
+		Properties:     notion.Properties{},
+	}
+	title := ""
+	if prop, ok := request.Properties["title"].(notion.TitleProperty); ok {
+		for _, rt := range prop.Title {
+			if rt.Text != nil {
+				title += rt.Text.Content
+			}
+		}
+		prop.Title = []notion.RichText{textSpan(title, notion.ColorDefault)}
+		page.Properties["title"] = &prop
+	}
+	child := &notion.ChildPageBlock{
+		BasicBlock: notion.BasicBlock{
+			Object:         notion.ObjectTypeBlock,
+			ID:             id,
+			Type:           notion.BlockTypeChildPage,
+			CreatedTime:    &now,
+			LastEditedTime: &now,
+			Parent:         &notion.Parent{Type: notion.ParentTypePageID, PageID: request.Parent.PageID},
+		},
+	}
+	child.ChildPage.Title = title
+	depth := 0
+	if d, ok := c.depth[notion.BlockID(request.Parent.PageID)]; ok {
+		depth = d + 1
+	}
+	c.seen[id] = child
+	c.depth[id] = depth
+	plan("+", utils.ColorGreen, depth, planLine(child))
+	return page, nil
+}
+
+func (c *dryRunClient) GetPage(ctx context.Context, id notion.PageID) (*notion.Page, error) {
+	if isPlanned(notion.BlockID(id)) {
+		return nil, fmt.Errorf("page %s is only planned in a dry run", id)
+	}
+	return c.NotionAPI.GetPage(ctx, id)
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haykh/nogo/config"
+
+	notion "github.com/jomei/notionapi"
+)
+
+var colorPattern = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// takePlanned returns the changes planned so far, without their colours.
+func takePlanned() []string {
+	planned.Lock()
+	defer planned.Unlock()
+	lines := []string{}
+	for _, line := range planned.lines {
+		lines = append(lines, colorPattern.ReplaceAllString(line, ""))
+	}
+	planned.lines = nil
+	return lines
+}
+
+func TestDryRun(t *testing.T) {
+	defer func(dryRun bool) { DryRun = dryRun }(DryRun)
+	DryRun = true
+	defer func(now func() time.Time) { Now = now }(Now)
+	Now = func() time.Time { return time.Now().Add(30 * 24 * time.Hour) }
+	tests := []struct {
+		name    string
+		entries []notion.Block
+		run     func(client NotionAPI, loc_config config.LocalParseTemplate, pageID string) error
+		want    []string
+	}{
+		{
+			name: "add",
+			run: func(client NotionAPI, _ config.LocalParseTemplate, pageID string) error {
+				return AddToStack(client, pageID, "buy milk", nil)
+			},
+			want: []string{"+ [ ] buy milk"},
+		},
+		{
+			name:    "toggle",
+			entries: []notion.Block{todo("buy milk", false)},
+			run: func(client NotionAPI, _ config.LocalParseTemplate, pageID string) error {
+				return ToggleStack(client, pageID, Selector{Keys: []string{"1"}}, false)
+			},
+			want: []string{"~ [x] buy milk"},
+		},
+		{
+			name:    "mod",
+			entries: []notion.Block{todo("buy milk", false)},
+			run: func(client NotionAPI, _ config.LocalParseTemplate, pageID string) error {
+				return ModifyStack(client, pageID, Selector{Keys: []string{"1"}}, "buy bread", nil)
+			},
+			want: []string{"~ [ ] buy bread  (was `buy milk`)"},
+		},
+		{
+			name:    "rm",
+			entries: []notion.Block{todo("buy milk", false), todo("call bob", false)},
+			run: func(client NotionAPI, _ config.LocalParseTemplate, pageID string) error {
+				return RmFromStack(client, pageID, Selector{Keys: []string{"2"}})
+			},
+			want: []string{"- [ ] call bob"},
+		},
+		{
+			name:    "auto-archive",
+			entries: []notion.Block{todo("done", true), todo("open", false)},
+			run: func(client NotionAPI, _ config.LocalParseTemplate, pageID string) error {
+				return autoArchive(client, "7d", pageID)
+			},
+			want: []string{"+ page: Done", "+   toggle: ...", "+     [x] done · done ...", "- [x] done"},
+		},
+		{
+			name: "set auto_archive_after",
+			run: func(_ NotionAPI, loc_config config.LocalParseTemplate, _ string) error {
+				if err := SetAutoArchiveAfter(loc_config, "7d"); err != nil {
+					return err
+				} else if after := loc_config.GetAutoArchiveAfter(); after != "" {
+					t.Errorf("auto_archive_after set to `%s` in a dry run", after)
+				}
+				return nil
+			},
+			want: []string{"~ config: auto_archive_after = 7d"},
+		},
+		{
+			name: "register a stack",
+			run: func(client NotionAPI, loc_config config.LocalParseTemplate, pageID string) error {
+				if err := RegisterStack(client, loc_config, "home", pageID, true); err != nil {
+					return err
+				} else if stacks := loc_config.GetStacks(); len(stacks) > 0 {
+					t.Errorf("stacks %v registered in a dry run", stacks)
+				}
+				return nil
+			},
+			want: []string{"~ config: stack `home` = PAGE"},
+		},
+		{
+			name: "alias a page",
+			run: func(client NotionAPI, loc_config config.LocalParseTemplate, pageID string) error {
+				if err := SaveAlias(client, loc_config, "inbox", pageID); err != nil {
+					return err
+				} else if aliases := loc_config.GetAliases(); len(aliases) > 0 {
+					t.Errorf("aliases %v saved in a dry run", aliases)
+				}
+				return nil
+			},
+			want: []string{"~ config: alias `inbox` = PAGE"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, pageID := newStack(t, tt.entries...)
+			before := stackState(t, f, pageID)
+			takePlanned()
+			if err := tt.run(withDryRun(f), config.LocalParseTemplate{}, pageID); err != nil {
+				t.Fatal(err)
+			}
+			if got := stackState(t, f, pageID); !reflect.DeepEqual(got, before) {
+				t.Errorf("dry run changed the stack to %q, want %q", got, before)
+			}
+			// `...` in a wanted line stands for anything, e.g. the week
+			got := takePlanned()
+			matches := len(got) == len(tt.want)
+			for i := 0; matches && i < len(got); i++ {
+				line := strings.ReplaceAll(regexp.QuoteMeta(tt.want[i]), `\.\.\.`, ".*")
+				line = strings.ReplaceAll(line, "PAGE", regexp.QuoteMeta(pageID))
+				matches = regexp.MustCompile("^" + line + "$").MatchString(got[i])
+			}
+			if !matches {
+				t.Errorf("planned %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"time"
+
+	notion "github.com/jomei/notionapi"
+)
+
+type Span struct {
+	Type          string `json:"type" yaml:"type"`
+	Text          string `json:"text" yaml:"text"`
+	Href          string `json:"href,omitempty" yaml:"href,omitempty"`
+	Bold          bool   `json:"bold,omitempty" yaml:"bold,omitempty"`
+	Italic        bool   `json:"italic,omitempty" yaml:"italic,omitempty"`
+	Strikethrough bool   `json:"strikethrough,omitempty" yaml:"strikethrough,omitempty"`
+	Underline     bool   `json:"underline,omitempty" yaml:"underline,omitempty"`
+	Code          bool   `json:"code,omitempty" yaml:"code,omitempty"`
+	Color         string `json:"color,omitempty" yaml:"color,omitempty"`
+}
+
+type StackEntry struct {
+	Index          int          `json:"index" yaml:"index"`
+	ID             string       `json:"id" yaml:"id"`
+	Text           string       `json:"text" yaml:"text"`
+	RichText       []Span       `json:"rich_text" yaml:"rich_text"`
+	Checked        bool         `json:"checked" yaml:"checked"`
+	CreatedTime    *time.Time   `json:"created_time,omitempty" yaml:"created_time,omitempty"`
+	LastEditedTime *time.Time   `json:"last_edited_time,omitempty" yaml:"last_edited_time,omitempty"`
+	Due            *time.Time   `json:"due,omitempty" yaml:"due,omitempty"`
+	Priority       string       `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Tags           []string     `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Subtasks       []StackEntry `json:"subtasks,omitempty" yaml:"subtasks,omitempty"`
+}
+
+type BlockEntry struct {
+	ID       string       `json:"id" yaml:"id"`
+	Type     string       `json:"type" yaml:"type"`
+	Text     string       `json:"text" yaml:"text"`
+	RichText []Span       `json:"rich_text,omitempty" yaml:"rich_text,omitempty"`
+	Checked  *bool        `json:"checked,omitempty" yaml:"checked,omitempty"`
+	Children []BlockEntry `json:"children,omitempty" yaml:"children,omitempty"`
+}
+
+type PageView struct {
+	ID     string       `json:"id" yaml:"id"`
+	Title  string       `json:"title" yaml:"title"`
+	URL    string       `json:"url" yaml:"url"`
+	Blocks []BlockEntry `json:"blocks" yaml:"blocks"`
+}
+
+func RichText2Spans(rts []notion.RichText) []Span {
+	spans := []Span{}
+	for _, rt := range rts {
+		span := Span{
+			Type: string(rt.Type),
+			Text: rt.PlainText,
+			Href: rt.Href,
+		}
+		if rt.Annotations != nil {
+			span.Bold = rt.Annotations.Bold
+			span.Italic = rt.Annotations.Italic
+			span.Strikethrough = rt.Annotations.Strikethrough
+			span.Underline = rt.Annotations.Underline
+			span.Code = rt.Annotations.Code
+			if rt.Annotations.Color != notion.ColorDefault {
+				span.Color = string(rt.Annotations.Color)
+			}
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+func NewStackEntry(idx int, b notion.Block) StackEntry {
+	rts := BlockRichText(b)
+	meta := ParseEntryMeta(rts)
+	entry := StackEntry{
+		Index:          idx,
+		ID:             string(b.GetID()),
+		Text:           RichText2Plain(rts),
+		RichText:       RichText2Spans(rts),
+		CreatedTime:    b.GetCreatedTime(),
+		LastEditedTime: b.GetLastEditedTime(),
+		Due:            meta.Due,
+		Priority:       meta.Priority.String(),
+		Tags:           meta.Tags,
+	}
+	if todo, ok := b.(*notion.ToDoBlock); ok {
+		entry.Checked = todo.ToDo.Checked
+	}
+	return entry
+}
+
+func NewStackEntries(blocks notion.Blocks) []StackEntry {
+	entries := []StackEntry{}
+	for i, b := range blocks {
+		entries = append(entries, NewStackEntry(i+1, b))
+	}
+	return entries
+}
+
+// NewStackEntryTree is NewStackEntries with the nested children of every
+// entry fetched as its subtasks.
+func NewStackEntryTree(client NotionAPI, blocks notion.Blocks) ([]StackEntry, error) {
+	entries := NewStackEntries(blocks)
+	for i, b := range blocks {
+		if b.GetHasChildren() {
+			if children, err := GetChildren(client, b.GetID()); err != nil {
+				return nil, err
+			} else if subtasks, err := NewStackEntryTree(client, children); err != nil {
+				return nil, err
+			} else {
+				entries[i].Subtasks = subtasks
+			}
+		}
+	}
+	return entries, nil
+}
+
+func NewBlockEntry(client NotionAPI, b notion.Block) (BlockEntry, error) {
+	rts := BlockRichText(b)
+	entry := BlockEntry{
+		ID:       string(b.GetID()),
+		Type:     string(b.GetType()),
+		Text:     RichText2Plain(rts),
+		RichText: RichText2Spans(rts),
+	}
+	switch b := b.(type) {
+	case *notion.ToDoBlock:
+		entry.Checked = &b.ToDo.Checked
+	case *notion.ChildPageBlock:
+		entry.Text = b.ChildPage.Title
+	case *notion.ChildDatabaseBlock:
+		entry.Text = b.ChildDatabase.Title
+	case *notion.EquationBlock:
+		entry.Text = b.Equation.Expression
+	}
+	switch b.GetType() {
+	case notion.BlockTypeChildPage, notion.BlockTypeChildDatabase:
+		return entry, nil
+	}
+	if b.GetHasChildren() {
+		if children, err := NewBlockEntries(client, b.GetID()); err != nil {
+			return BlockEntry{}, err
+		} else {
+			entry.Children = children
+		}
+	}
+	return entry, nil
+}
+
+func NewBlockEntries(client NotionAPI, blockID notion.BlockID) ([]BlockEntry, error) {
+	entries := []BlockEntry{}
+	if err := ForEachChild(client, blockID, func(b notion.Block) error {
+		if entry, err := NewBlockEntry(client, b); err != nil {
+			return err
+		} else {
+			entries = append(entries, entry)
+			return nil
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	notion "github.com/jomei/notionapi"
+)
+
+func writeOut(out string, content string) error {
+	if out == "" || out == "-" {
+		fmt.Print(content)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0770); err != nil {
+		return err
+	}
+	return os.WriteFile(out, []byte(content), 0644)
+}
+
+func ExportPage(client NotionAPI, pageID, format, out string, recursive bool) error {
+	switch strings.ToLower(format) {
+	case "md", "markdown":
+		if recursive {
+			if out == "" || out == "-" {
+				return fmt.Errorf("recursive export needs an output directory")
+			}
+			return ExportTree(client, pageID, out)
+		}
+		if md, err := NewMarkdownRenderer(client).Page(pageID); err != nil {
+			return err
+		} else {
+			return writeOut(out, md)
+		}
+	default:
+		return fmt.Errorf("unknown export format `%s` (md)", format)
+	}
+}
+
+type exportNode struct {
+	id       string
+	title    string
+	path     string
+	database bool
+	children []*exportNode
+}
+
+type treeExporter struct {
+	client NotionAPI
+	// http downloads the files hosted by notion, each within --timeout
+	http   *http.Client
+	root   string
+	nodes  map[string]*exportNode
+	paths  map[string]bool
+	assets map[string]string
+}
+
+func slugify(title string) string {
+	slug := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, strings.TrimSpace(title))
+	for strings.Contains(slug, "--") {
+		slug = strings.ReplaceAll(slug, "--", "-")
+	}
+	return strings.Trim(slug, "-")
+}
+
+func (e *treeExporter) uniquePath(dir, title, id string) string {
+	slug := slugify(title)
+	if slug == "" {
+		slug = strings.ReplaceAll(id, "-", "")
+	}
+	path := filepath.Join(dir, slug+".md")
+	for i := 2; e.paths[path]; i++ {
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d.md", slug, i))
+	}
+	e.paths[path] = true
+	return path
+}
+
+func (e *treeExporter) addNode(parent *exportNode, id, title string, database bool) *exportNode {
+	dir := ""
+	if parent != nil {
+		dir = strings.TrimSuffix(parent.path, ".md")
+	}
+	node := &exportNode{id: id, title: title, database: database}
+	node.path = e.uniquePath(dir, title, id)
+	e.nodes[normalizeID(id)] = node
+	if parent != nil {
+		parent.children = append(parent.children, node)
+	}
+	return node
+}
+
+func (e *treeExporter) discoverBlocks(node *exportNode, blockID notion.BlockID) error {
+	return ForEachChild(e.client, blockID, func(b notion.Block) error {
+		switch b := b.(type) {
+		case *notion.ChildPageBlock:
+			if _, seen := e.nodes[normalizeID(string(b.ID))]; !seen {
+				return e.discoverPage(e.addNode(node, string(b.ID), b.ChildPage.Title, false))
+			}
+			return nil
+		case *notion.ChildDatabaseBlock:
+			if _, seen := e.nodes[normalizeID(string(b.ID))]; !seen {
+				return e.discoverDatabase(e.addNode(node, string(b.ID), b.ChildDatabase.Title, true))
+			}
+			return nil
+		}
+		if b.GetHasChildren() {
+			return e.discoverBlocks(node, b.GetID())
+		}
+		return nil
+	})
+}
+
+func (e *treeExporter) discoverPage(node *exportNode) error {
+	return e.discoverBlocks(node, notion.BlockID(node.id))
+}
+
+func (e *treeExporter) discoverDatabase(node *exportNode) error {
+	request := &notion.DatabaseQueryRequest{PageSize: childrenPageSize}
+	for {
+		if response, err := e.client.QueryDatabase(context.Background(), notion.DatabaseID(node.id), request); err != nil {
+			return fmt.Errorf("failed to query database `%s`: %w", node.title, err)
+		} else {
+			for i := range response.Results {
+				page := &response.Results[i]
+				if err := e.discoverPage(e.addNode(node, string(page.ID), PageTitle(page), false)); err != nil {
+					return err
+				}
+			}
+			if !response.HasMore || response.NextCursor == "" {
+				return nil
+			}
+			request.StartCursor = response.NextCursor
+		}
+	}
+}
+
+func relativeLink(from, to string) string {
+	if rel, err := filepath.Rel(filepath.Dir(from), to); err != nil {
+		return to
+	} else {
+		return (&url.URL{Path: filepath.ToSlash(rel)}).EscapedPath()
+	}
+}
+
+func (e *treeExporter) download(blockID, fileURL string) (string, error) {
+	if path, ok := e.assets[fileURL]; ok {
+		return path, nil
+	}
+	request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, fileURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to download asset: %w", err)
+	}
+	response, err := e.http.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to download asset: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return "", fmt.Errorf("failed to download asset: %s", response.Status)
+	}
+	ext := ""
+	if u, err := url.Parse(fileURL); err == nil {
+		ext = filepath.Ext(u.Path)
+	}
+	if ext == "" {
+		if exts, err := mime.ExtensionsByType(response.Header.Get("Content-Type")); err == nil && len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	path := filepath.Join("assets", strings.ReplaceAll(blockID, "-", "")+ext)
+	if err := os.MkdirAll(filepath.Join(e.root, "assets"), 0770); err != nil {
+		return "", err
+	}
+	if f, err := os.Create(filepath.Join(e.root, path)); err != nil {
+		return "", err
+	} else {
+		defer f.Close()
+		if _, err := io.Copy(f, response.Body); err != nil {
+			return "", err
+		}
+	}
+	e.assets[fileURL] = path
+	return path, nil
+}
+
+func (e *treeExporter) renderer(node *exportNode) *MarkdownRenderer {
+	r := NewMarkdownRenderer(e.client)
+	r.PageLink = func(id string) string {
+		if target, ok := e.nodes[normalizeID(id)]; ok {
+			return relativeLink(node.path, target.path)
+		}
+		return PageURL(id)
+	}
+	r.Asset = func(blockID, fileURL string) (string, error) {
+		if path, err := e.download(blockID, fileURL); err != nil {
+			return "", err
+		} else {
+			return relativeLink(node.path, path), nil
+		}
+	}
+	return r
+}
+
+func (e *treeExporter) export(node *exportNode) error {
+	var content string
+	if node.database {
+		content = "# " + markdownEscaper.Replace(node.title) + "\n"
+		if len(node.children) > 0 {
+			content += "\n"
+		}
+		for _, child := range node.children {
+			content += fmt.Sprintf("- [%s](%s)\n", markdownEscaper.Replace(child.title), relativeLink(node.path, child.path))
+		}
+	} else {
+		if md, err := e.renderer(node).Page(node.id); err != nil {
+			return fmt.Errorf("failed to export `%s`: %w", node.title, err)
+		} else {
+			content = md
+		}
+	}
+	if err := writeOut(filepath.Join(e.root, node.path), content); err != nil {
+		return err
+	}
+	for _, child := range node.children {
+		if err := e.export(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ExportTree(client NotionAPI, pageID, dir string) error {
+	e := &treeExporter{
+		client: newMemoClient(client),
+		http:   &http.Client{Timeout: Timeout},
+		root:   dir,
+		nodes:  map[string]*exportNode{},
+		paths:  map[string]bool{},
+		assets: map[string]string{},
+	}
+	if page, err := e.client.GetPage(context.Background(), notion.PageID(pageID)); err != nil {
+		return fmt.Errorf("failed to get page: %w", err)
+	} else {
+		root := e.addNode(nil, pageID, PageTitle(page), false)
+		if err := e.discoverPage(root); err != nil {
+			return err
+		}
+		return e.export(root)
+	}
+}
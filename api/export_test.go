@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	notion "github.com/jomei/notionapi"
+)
+
+func image(url string) *notion.ImageBlock {
+	return &notion.ImageBlock{
+		BasicBlock: basic(notion.BlockTypeImage),
+		Image:      notion.Image{Type: "file", File: &notion.FileObject{URL: url}},
+	}
+}
+
+func exported(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExportTree(t *testing.T) {
+	downloads := 0
+	assets := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cat.png" {
+			http.NotFound(w, r)
+			return
+		}
+		downloads++
+		w.Write([]byte("meow"))
+	}))
+	defer assets.Close()
+
+	f := NewFakeNotion(t)
+	root := f.AddPage("", "Wiki", "")
+	child := f.AddPage(root, "Child Page", "")
+	tasks := f.AddDatabase(root, "Tasks")
+	if _, err := f.CreatePage(context.Background(), &notion.PageCreateRequest{
+		Parent: notion.Parent{Type: notion.ParentTypeDatabaseID, DatabaseID: tasks},
+		Properties: map[string]notion.Property{
+			"Name": notion.TitleProperty{Type: "title", Title: text("Do it")},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	link := notion.RichText{Type: "text", PlainText: "see", Text: &notion.Text{Content: "see", Link: &notion.Link{Url: PageURL(string(child))}}}
+	cat := f.AddBlocks(notion.BlockID(root),
+		&notion.ParagraphBlock{BasicBlock: basic(notion.BlockTypeParagraph), Paragraph: notion.Paragraph{RichText: []notion.RichText{link}}},
+		image(assets.URL+"/cat.png"),
+	)[1]
+	f.AddBlocks(notion.BlockID(child),
+		image(assets.URL+"/cat.png"),
+		&notion.LinkToPageBlock{
+			BasicBlock: basic(notion.BlockTypeLinkToPage),
+			LinkToPage: notion.LinkToPage{Type: "page_id", PageID: root},
+		},
+	)
+
+	dir := t.TempDir()
+	if err := ExportTree(f, string(root), dir); err != nil {
+		t.Fatal(err)
+	}
+	asset := "assets/" + strings.ReplaceAll(string(cat), "-", "") + ".png"
+	files := exported(t, dir)
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	paths := []string{"Wiki.md", "Wiki/Child-Page.md", "Wiki/Tasks.md", "Wiki/Tasks/Do-it.md", asset}
+	sort.Strings(paths)
+	if !reflect.DeepEqual(names, paths) {
+		t.Fatalf("exported %q, want %q", names, paths)
+	}
+	want := map[string]string{
+		"Wiki.md":             "# Wiki\n\n[Child Page](Wiki/Child-Page.md)\n\n[Tasks](Wiki/Tasks.md)\n\n[see](Wiki/Child-Page.md)\n\n![](" + asset + ")\n",
+		"Wiki/Child-Page.md":  "# Child Page\n\n![](../" + asset + ")\n\n[../Wiki.md](../Wiki.md)\n",
+		"Wiki/Tasks.md":       "# Tasks\n\n- [Do it](Tasks/Do-it.md)\n",
+		"Wiki/Tasks/Do-it.md": "# Do it\n",
+		asset:                 "meow",
+	}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("%s: got\n%q\nwant\n%q", name, files[name], content)
+		}
+	}
+	if downloads != 1 {
+		t.Errorf("the shared image was downloaded %d times, want once", downloads)
+	}
+
+	f.AddBlocks(notion.BlockID(child), image(assets.URL+"/gone.png"))
+	if err := ExportTree(f, string(root), t.TempDir()); err == nil || !strings.Contains(err.Error(), "failed to download asset: 404") {
+		t.Errorf("got %v, want the failed download", err)
+	}
+}
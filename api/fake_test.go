@@ -0,0 +1,656 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// FakeNotion is an in-memory notion: a block tree with pages, databases and
+// users, enough to run every command offline.
+type FakeNotion struct {
+	t         testing.TB
+	mu        sync.Mutex
+	blocks    map[notion.BlockID]notion.Block
+	children  map[notion.BlockID][]notion.BlockID
+	pages     map[notion.PageID]*notion.Page
+	databases map[notion.DatabaseID]*notion.Database
+	users     map[notion.UserID]*notion.User
+	// trash remembers the sibling deleted blocks came after, to restore them
+	// in place
+	trash  map[notion.BlockID]notion.BlockID
+	lastID int
+	Now    func() time.Time
+}
+
+func NewFakeNotion(t testing.TB) *FakeNotion {
+	return &FakeNotion{
+		t:         t,
+		blocks:    map[notion.BlockID]notion.Block{},
+		children:  map[notion.BlockID][]notion.BlockID{},
+		pages:     map[notion.PageID]*notion.Page{},
+		databases: map[notion.DatabaseID]*notion.Database{},
+		users:     map[notion.UserID]*notion.User{},
+		trash:     map[notion.BlockID]notion.BlockID{},
+		Now:       time.Now,
+	}
+}
+
+func (f *FakeNotion) newID() string {
+	f.lastID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012x", f.lastID)
+}
+
+func clonePage(p *notion.Page) (*notion.Page, error) {
+	if data, err := json.Marshal(p); err != nil {
+		return nil, err
+	} else {
+		var page notion.Page
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, err
+		}
+		return &page, nil
+	}
+}
+
+func (f *FakeNotion) insert(parent notion.BlockID, after notion.BlockID, blocks notion.Blocks) (notion.Blocks, error) {
+	created := notion.Blocks{}
+	ids := []notion.BlockID{}
+	for _, block := range blocks {
+		clone, err := cloneBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		nested := takeChildren(clone)
+		normalizeRichText(reflect.ValueOf(clone))
+		now := f.Now()
+		basic := basicBlock(clone)
+		basic.Object = notion.ObjectTypeBlock
+		basic.ID = notion.BlockID(f.newID())
+		basic.CreatedTime = &now
+		basic.LastEditedTime = &now
+		basic.Archived = false
+		basic.Parent = &notion.Parent{Type: notion.ParentTypeBlockID, BlockID: parent}
+		f.blocks[basic.ID] = clone
+		if len(nested) > 0 {
+			if _, err := f.insert(basic.ID, "", nested); err != nil {
+				return nil, err
+			}
+		}
+		ids = append(ids, basic.ID)
+		created = append(created, clone)
+	}
+	siblings := f.children[parent]
+	pos := len(siblings)
+	if after != "" {
+		pos = -1
+		for i, id := range siblings {
+			if id == after {
+				pos = i + 1
+				break
+			}
+		}
+		if pos == -1 {
+			return nil, fmt.Errorf("block %s is not a child of %s", after, parent)
+		}
+	}
+	merged := append([]notion.BlockID{}, siblings[:pos]...)
+	merged = append(merged, ids...)
+	f.children[parent] = append(merged, siblings[pos:]...)
+	f.syncHasChildren(parent)
+	f.touch(parent, f.Now())
+	return created, nil
+}
+
+// touch bumps the last_edited_time of the page a block is on, as notion does
+// for any change to its blocks (but not to those of its sub-pages).
+func (f *FakeNotion) touch(id notion.BlockID, now time.Time) {
+	for id != "" {
+		if page, ok := f.pages[notion.PageID(id)]; ok {
+			page.LastEditedTime = now
+			if block, ok := f.blocks[id]; ok {
+				basicBlock(block).LastEditedTime = &now
+			}
+			return
+		} else if block, ok := f.blocks[id]; ok {
+			id = parentOf(block)
+		} else {
+			return
+		}
+	}
+}
+
+func (f *FakeNotion) syncHasChildren(id notion.BlockID) {
+	if block, ok := f.blocks[id]; ok {
+		basicBlock(block).HasChildren = len(f.children[id]) > 0
+	}
+}
+
+// parentOf is the block or page a block sits in.
+func parentOf(b notion.Block) notion.BlockID {
+	if parent := basicBlock(b).Parent; parent == nil {
+		return ""
+	} else if parent.BlockID != "" {
+		return parent.BlockID
+	} else {
+		return notion.BlockID(parent.PageID)
+	}
+}
+
+func (f *FakeNotion) detach(id notion.BlockID) {
+	block, ok := f.blocks[id]
+	if !ok || basicBlock(block).Parent == nil {
+		return
+	}
+	parent := parentOf(block)
+	siblings := f.children[parent]
+	for i, sibling := range siblings {
+		if sibling == id {
+			f.children[parent] = append(siblings[:i:i], siblings[i+1:]...)
+			break
+		}
+	}
+	f.syncHasChildren(parent)
+}
+
+func (f *FakeNotion) AddPage(parent notion.PageID, title, icon string) notion.PageID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	request := &notion.PageCreateRequest{
+		Parent: notion.Parent{Type: notion.ParentTypePageID, PageID: parent},
+		Properties: map[string]notion.Property{
+			"title": notion.TitleProperty{
+				Type:  "title",
+				Title: []notion.RichText{{Type: "text", PlainText: title, Text: &notion.Text{Content: title}}},
+			},
+		},
+	}
+	if icon != "" {
+		emoji := notion.Emoji(icon)
+		request.Icon = &notion.Icon{Type: "emoji", Emoji: &emoji}
+	}
+	page, err := f.createPage(request)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return notion.PageID(page.ID)
+}
+
+func (f *FakeNotion) AddBlocks(parent notion.BlockID, blocks ...notion.Block) []notion.BlockID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	created, err := f.insert(parent, "", blocks)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	ids := []notion.BlockID{}
+	for _, block := range created {
+		ids = append(ids, block.GetID())
+	}
+	return ids
+}
+
+func (f *FakeNotion) Block(id notion.BlockID) notion.Block {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.blocks[id]
+}
+
+func (f *FakeNotion) Children(id notion.BlockID) notion.Blocks {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result := notion.Blocks{}
+	for _, child := range f.children[id] {
+		result = append(result, f.blocks[child])
+	}
+	return result
+}
+
+func (f *FakeNotion) GetBlock(_ context.Context, id notion.BlockID) (notion.Block, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if block, ok := f.blocks[id]; !ok {
+		return nil, fmt.Errorf("block %s not found", id)
+	} else {
+		return cloneBlock(block)
+	}
+}
+
+func (f *FakeNotion) GetBlockChildren(_ context.Context, id notion.BlockID, pagination *notion.Pagination) (*notion.GetChildrenResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, isBlock := f.blocks[id]
+	_, isPage := f.pages[notion.PageID(id)]
+	if !isBlock && !isPage {
+		return nil, fmt.Errorf("block %s not found", id)
+	}
+	start, size := 0, childrenPageSize
+	if pagination != nil {
+		if pagination.StartCursor != "" {
+			if cursor, err := strconv.Atoi(string(pagination.StartCursor)); err != nil {
+				return nil, fmt.Errorf("invalid cursor: %w", err)
+			} else {
+				start = cursor
+			}
+		}
+		if pagination.PageSize > 0 {
+			size = pagination.PageSize
+		}
+	}
+	ids := f.children[id]
+	end := min(start+size, len(ids))
+	response := &notion.GetChildrenResponse{Object: notion.ObjectTypeList, Results: notion.Blocks{}}
+	for _, child := range ids[min(start, end):end] {
+		if clone, err := cloneBlock(f.blocks[child]); err != nil {
+			return nil, err
+		} else {
+			response.Results = append(response.Results, clone)
+		}
+	}
+	if end < len(ids) {
+		response.HasMore = true
+		response.NextCursor = strconv.Itoa(end)
+	}
+	return response, nil
+}
+
+func (f *FakeNotion) AppendBlockChildren(_ context.Context, id notion.BlockID, request *notion.AppendBlockChildrenRequest) (*notion.AppendBlockChildrenResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, isBlock := f.blocks[id]
+	_, isPage := f.pages[notion.PageID(id)]
+	if !isBlock && !isPage {
+		return nil, fmt.Errorf("block %s not found", id)
+	}
+	if len(request.Children) > 100 {
+		return nil, fmt.Errorf("cannot append more than 100 children at once, got %d", len(request.Children))
+	}
+	for _, b := range request.Children {
+		if nested := nestedChildren(b); len(nested) > 100 {
+			return nil, fmt.Errorf("cannot create a %s with more than 100 children, got %d", b.GetType(), len(nested))
+		}
+	}
+	if created, err := f.insert(id, request.After, request.Children); err != nil {
+		return nil, err
+	} else {
+		return &notion.AppendBlockChildrenResponse{Object: notion.ObjectTypeList, Results: created}, nil
+	}
+}
+
+func (f *FakeNotion) UpdateBlock(_ context.Context, id notion.BlockID, request *notion.BlockUpdateRequest) (notion.Block, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	block, ok := f.blocks[id]
+	if !ok || basicBlock(block).Archived {
+		return nil, fmt.Errorf("block %s not found", id)
+	}
+	if err := applyRequest(block, request); err != nil {
+		return nil, err
+	}
+	now := f.Now()
+	basicBlock(block).LastEditedTime = &now
+	f.touch(parentOf(block), now)
+	return cloneBlock(block)
+}
+
+func (f *FakeNotion) DeleteBlock(_ context.Context, id notion.BlockID) (notion.Block, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	block, ok := f.blocks[id]
+	if !ok || basicBlock(block).Archived {
+		return nil, fmt.Errorf("block %s not found", id)
+	}
+	if parent := parentOf(block); parent != "" {
+		f.trash[id] = ""
+		for _, sibling := range f.children[parent] {
+			if sibling == id {
+				break
+			}
+			f.trash[id] = sibling
+		}
+	}
+	f.detach(id)
+	now := f.Now()
+	basicBlock(block).Archived = true
+	basicBlock(block).LastEditedTime = &now
+	f.touch(parentOf(block), now)
+	return cloneBlock(block)
+}
+
+func (f *FakeNotion) RestoreBlock(_ context.Context, id notion.BlockID) (notion.Block, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	block, ok := f.blocks[id]
+	if !ok {
+		return nil, fmt.Errorf("block %s not found", id)
+	}
+	if basic := basicBlock(block); basic.Archived && basic.Parent != nil {
+		parent := parentOf(block)
+		siblings := f.children[parent]
+		// back after the sibling it followed, or first if that one is gone too
+		pos := 0
+		for i, sibling := range siblings {
+			if sibling == f.trash[id] {
+				pos = i + 1
+			}
+		}
+		merged := append([]notion.BlockID{}, siblings[:pos]...)
+		merged = append(merged, id)
+		f.children[parent] = append(merged, siblings[pos:]...)
+		f.syncHasChildren(parent)
+		delete(f.trash, id)
+		now := f.Now()
+		basic.Archived = false
+		basic.LastEditedTime = &now
+		f.touch(parent, now)
+	}
+	return cloneBlock(block)
+}
+
+func (f *FakeNotion) GetPage(_ context.Context, id notion.PageID) (*notion.Page, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if page, ok := f.pages[id]; !ok {
+		return nil, fmt.Errorf("page %s not found", id)
+	} else {
+		return clonePage(page)
+	}
+}
+
+func (f *FakeNotion) createPage(request *notion.PageCreateRequest) (*notion.Page, error) {
+	now := f.Now()
+	page, err := clonePage(&notion.Page{
+		Object:         notion.ObjectTypePage,
+		ID:             notion.ObjectID(f.newID()),
+		CreatedTime:    now,
+		LastEditedTime: now,
+		Properties:     request.Properties,
+		Parent:         request.Parent,
+		Icon:           request.Icon,
+	})
+	if err != nil {
+		return nil, err
+	}
+	normalizeRichText(reflect.ValueOf(page))
+	page.URL = PageURL(string(page.ID))
+	f.pages[notion.PageID(page.ID)] = page
+	parent := notion.BlockID(request.Parent.PageID)
+	if request.Parent.DatabaseID != "" {
+		return page, nil
+	}
+	title := ""
+	if prop, ok := page.Properties["title"].(*notion.TitleProperty); ok {
+		for _, rt := range prop.Title {
+			title += rt.PlainText
+		}
+	}
+	child := &notion.ChildPageBlock{
+		BasicBlock: notion.BasicBlock{
+			Object:         notion.ObjectTypeBlock,
+			ID:             notion.BlockID(page.ID),
+			Type:           notion.BlockTypeChildPage,
+			CreatedTime:    &now,
+			LastEditedTime: &now,
+			Parent:         &notion.Parent{Type: notion.ParentTypePageID, PageID: request.Parent.PageID},
+		},
+	}
+	child.ChildPage.Title = title
+	f.blocks[child.ID] = child
+	f.children[parent] = append(f.children[parent], child.ID)
+	f.syncHasChildren(parent)
+	f.touch(parent, now)
+	return page, nil
+}
+
+func (f *FakeNotion) CreatePage(_ context.Context, request *notion.PageCreateRequest) (*notion.Page, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if request.Parent.PageID != "" {
+		if _, ok := f.pages[request.Parent.PageID]; !ok {
+			return nil, fmt.Errorf("page %s not found", request.Parent.PageID)
+		}
+	}
+	if page, err := f.createPage(request); err != nil {
+		return nil, err
+	} else {
+		return clonePage(page)
+	}
+}
+
+func (f *FakeNotion) AddDatabase(parent notion.PageID, title string) notion.DatabaseID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.Now()
+	id := notion.DatabaseID(f.newID())
+	f.databases[id] = &notion.Database{
+		Object:         notion.ObjectTypeDatabase,
+		ID:             notion.ObjectID(id),
+		CreatedTime:    now,
+		LastEditedTime: now,
+		Title:          []notion.RichText{{Type: "text", PlainText: title, Text: &notion.Text{Content: title}}},
+		Parent:         notion.Parent{Type: notion.ParentTypePageID, PageID: parent},
+		URL:            PageURL(string(id)),
+	}
+	normalizeRichText(reflect.ValueOf(f.databases[id]))
+	child := &notion.ChildDatabaseBlock{
+		BasicBlock: notion.BasicBlock{
+			Object:         notion.ObjectTypeBlock,
+			ID:             notion.BlockID(id),
+			Type:           notion.BlockTypeChildDatabase,
+			CreatedTime:    &now,
+			LastEditedTime: &now,
+			Parent:         &notion.Parent{Type: notion.ParentTypePageID, PageID: parent},
+		},
+	}
+	child.ChildDatabase.Title = title
+	f.blocks[child.ID] = child
+	f.children[notion.BlockID(parent)] = append(f.children[notion.BlockID(parent)], child.ID)
+	f.syncHasChildren(notion.BlockID(parent))
+	return id
+}
+
+func (f *FakeNotion) GetDatabase(_ context.Context, id notion.DatabaseID) (*notion.Database, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if db, ok := f.databases[id]; !ok {
+		return nil, fmt.Errorf("database %s not found", id)
+	} else {
+		clone := *db
+		return &clone, nil
+	}
+}
+
+func (f *FakeNotion) QueryDatabase(_ context.Context, id notion.DatabaseID, _ *notion.DatabaseQueryRequest) (*notion.DatabaseQueryResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.databases[id]; !ok {
+		return nil, fmt.Errorf("database %s not found", id)
+	}
+	response := &notion.DatabaseQueryResponse{Object: notion.ObjectTypeList, Results: []notion.Page{}}
+	for _, page := range f.pages {
+		if page.Parent.DatabaseID == id && !page.Archived {
+			if clone, err := clonePage(page); err != nil {
+				return nil, err
+			} else {
+				response.Results = append(response.Results, *clone)
+			}
+		}
+	}
+	return response, nil
+}
+
+func (f *FakeNotion) Search(_ context.Context, request *notion.SearchRequest) (*notion.SearchResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	query := strings.ToLower(request.Query)
+	objectType := request.Filter.Value
+	response := &notion.SearchResponse{Object: notion.ObjectTypeList, Results: []notion.Object{}}
+	if objectType == "" || objectType == "page" {
+		for _, page := range f.pages {
+			title := ""
+			if prop, ok := page.Properties["title"].(*notion.TitleProperty); ok {
+				for _, rt := range prop.Title {
+					title += rt.PlainText
+				}
+			}
+			if !page.Archived && strings.Contains(strings.ToLower(title), query) {
+				if clone, err := clonePage(page); err != nil {
+					return nil, err
+				} else {
+					response.Results = append(response.Results, clone)
+				}
+			}
+		}
+	}
+	if objectType == "" || objectType == "database" {
+		for _, db := range f.databases {
+			title := ""
+			for _, rt := range db.Title {
+				title += rt.PlainText
+			}
+			if strings.Contains(strings.ToLower(title), query) {
+				clone := *db
+				response.Results = append(response.Results, &clone)
+			}
+		}
+	}
+	// maps are unordered, so order by id first for stable pages
+	sort.Slice(response.Results, func(a, b int) bool {
+		_, ia := lastEdited(response.Results[a])
+		_, ib := lastEdited(response.Results[b])
+		return ia < ib
+	})
+	if request.Sort != nil {
+		sort.SliceStable(response.Results, func(a, b int) bool {
+			ta, _ := lastEdited(response.Results[a])
+			tb, _ := lastEdited(response.Results[b])
+			if request.Sort.Direction == notion.SortOrderASC {
+				return ta.Before(tb)
+			}
+			return ta.After(tb)
+		})
+	}
+	start, size := 0, 100
+	if request.StartCursor != "" {
+		if cursor, err := strconv.Atoi(string(request.StartCursor)); err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		} else {
+			start = cursor
+		}
+	}
+	if request.PageSize > 0 {
+		size = request.PageSize
+	}
+	end := min(start+size, len(response.Results))
+	if end < len(response.Results) {
+		response.HasMore = true
+		response.NextCursor = notion.Cursor(strconv.Itoa(end))
+	}
+	response.Results = response.Results[min(start, end):end]
+	return response, nil
+}
+
+// lastEdited is when a search result was last edited, and its id.
+func lastEdited(o notion.Object) (time.Time, string) {
+	switch o := o.(type) {
+	case *notion.Page:
+		return o.LastEditedTime, string(o.ID)
+	case *notion.Database:
+		return o.LastEditedTime, string(o.ID)
+	default:
+		return time.Time{}, ""
+	}
+}
+
+func (f *FakeNotion) AddUser(name string) notion.UserID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := notion.UserID(f.newID())
+	f.users[id] = &notion.User{Object: notion.ObjectTypeUser, ID: id, Type: notion.UserTypePerson, Name: name}
+	return id
+}
+
+func (f *FakeNotion) GetUser(_ context.Context, id notion.UserID) (*notion.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if user, ok := f.users[id]; !ok {
+		return nil, fmt.Errorf("user %s not found", id)
+	} else {
+		clone := *user
+		return &clone, nil
+	}
+}
+
+func todo(text string, checked bool, subtasks ...notion.Block) *notion.ToDoBlock {
+	return &notion.ToDoBlock{
+		BasicBlock: notion.BasicBlock{Object: notion.ObjectTypeBlock, Type: notion.BlockTypeToDo},
+		ToDo: notion.ToDo{
+			RichText: []notion.RichText{textSpan(text, notion.ColorDefault)},
+			Checked:  checked,
+			Children: subtasks,
+		},
+	}
+}
+
+// newStack creates a page whose stack holds the given entries.
+func newStack(t testing.TB, entries ...notion.Block) (*FakeNotion, string) {
+	f := NewFakeNotion(t)
+	return f, newStackIn(f, entries...)
+}
+
+// newStackIn is newStack on a given fake, e.g. one with its clock set.
+func newStackIn(f *FakeNotion, entries ...notion.Block) string {
+	page := f.AddPage("", "Stack", "")
+	stack := f.AddBlocks(notion.BlockID(page), &notion.ToggleBlock{
+		BasicBlock: notion.BasicBlock{Object: notion.ObjectTypeBlock, Type: notion.BlockTypeToggle},
+		Toggle:     notion.Toggle{RichText: []notion.RichText{textSpan("stack", notion.ColorDefault)}},
+	})
+	if len(entries) > 0 {
+		f.AddBlocks(stack[0], entries...)
+	}
+	return string(page)
+}
+
+// stackState lists the entries of a stack as `[x] text`, sub-tasks indented.
+func stackState(t testing.TB, f NotionAPI, pageID string) []string {
+	t.Helper()
+	entries, err := GetStackEntries(f, pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := NewStackEntryTree(f, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := []string{}
+	var walk func(entries []StackEntry, prefix string)
+	walk = func(entries []StackEntry, prefix string) {
+		for _, e := range entries {
+			box := "[ ]"
+			if e.Checked {
+				box = "[x]"
+			}
+			state = append(state, prefix+box+" "+e.Text)
+			walk(e.Subtasks, prefix+"  ")
+		}
+	}
+	walk(tree, "")
+	return state
+}
+
+// nestedChildren are the children sent inline with a block (see takeChildren).
+func nestedChildren(b notion.Block) notion.Blocks {
+	if clone, err := cloneBlock(b); err == nil {
+		return takeChildren(clone)
+	}
+	return nil
+}
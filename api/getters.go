@@ -3,7 +3,6 @@ package api
 import (
 	"context"
 	"fmt"
-	"regexp"
 	"strings"
 
 	"github.com/haykh/nogo/utils"
@@ -11,8 +10,40 @@ import (
 	notion "github.com/jomei/notionapi"
 )
 
-func GetStack(client *notion.Client, pageID string) (notion.Block, error) {
-	if parent, err := client.Block.GetChildren(context.Background(), notion.BlockID(pageID), nil); err != nil {
+const childrenPageSize = 100
+
+func ForEachChild(client NotionAPI, blockID notion.BlockID, fn func(notion.Block) error) error {
+	pagination := &notion.Pagination{PageSize: childrenPageSize}
+	for {
+		if children, err := client.GetBlockChildren(context.Background(), blockID, pagination); err != nil {
+			return err
+		} else {
+			for _, child := range children.Results {
+				if err := fn(child); err != nil {
+					return err
+				}
+			}
+			if !children.HasMore || children.NextCursor == "" {
+				return nil
+			}
+			pagination.StartCursor = notion.Cursor(children.NextCursor)
+		}
+	}
+}
+
+func GetChildren(client NotionAPI, blockID notion.BlockID) (notion.Blocks, error) {
+	blocks := notion.Blocks{}
+	if err := ForEachChild(client, blockID, func(b notion.Block) error {
+		blocks = append(blocks, b)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func GetStack(client NotionAPI, pageID string) (notion.Block, error) {
+	if parent, err := client.GetBlockChildren(context.Background(), notion.BlockID(pageID), nil); err != nil {
 		return nil, err
 	} else if len(parent.Results) == 0 {
 		return nil, fmt.Errorf("no parent found")
@@ -21,19 +52,15 @@ func GetStack(client *notion.Client, pageID string) (notion.Block, error) {
 	}
 }
 
-func GetStackEntries(client *notion.Client, pageID string) (notion.Blocks, error) {
+func GetStackEntries(client NotionAPI, pageID string) (notion.Blocks, error) {
 	if stack, err := GetStack(client, pageID); err != nil {
 		return nil, err
 	} else {
-		if entries, err := client.Block.GetChildren(context.Background(), stack.GetID(), nil); err != nil {
-			return nil, err
-		} else {
-			return entries.Results, nil
-		}
+		return GetChildren(client, stack.GetID())
 	}
 }
 
-func ParseStack(client *notion.Client, pageID string) (*[]string, *[]string, *[]bool, error) {
+func ParseStack(client NotionAPI, pageID string) (*[]string, *[]string, *[]bool, error) {
 	if entries, err := GetStackEntries(client, pageID); err != nil {
 		return nil, nil, nil, err
 	} else {
@@ -41,20 +68,133 @@ func ParseStack(client *notion.Client, pageID string) (*[]string, *[]string, *[]
 	}
 }
 
-func ParseStackFromBlocks(client *notion.Client, blocks notion.Blocks, pageID string) (*[]string, *[]string, *[]bool, error) {
+func ParseStackFromBlocks(client NotionAPI, blocks notion.Blocks, pageID string) (*[]string, *[]string, *[]bool, error) {
 	rich := []string{}
 	plain := []string{}
 	marked := []bool{}
-	for _, entry := range blocks {
-		if todo_str, err := Block2String(client, entry, 0); err != nil {
+	rc := NewRenderContext(client)
+	rc.Depth = 0
+	for i, block := range blocks {
+		if todo_str, err := Block2String(rc, block); err != nil {
 			return nil, nil, nil, err
 		} else {
-			rt := utils.Clean(todo_str)
-			pl := utils.Clean(regexp.MustCompile(`\[.*?\]`).ReplaceAllString(rt, ""))
-			rich = append(rich, rt)
-			plain = append(plain, pl)
-			marked = append(marked, strings.Contains(rt, "✓"))
+			entry := NewStackEntry(i+1, withRichText(block, ResolveMentions(client, BlockRichText(block))))
+			rich = append(rich, utils.Clean(todo_str))
+			plain = append(plain, entry.Text)
+			marked = append(marked, entry.Checked)
 		}
 	}
 	return &rich, &plain, &marked, nil
 }
+
+func BlockRichText(b notion.Block) []notion.RichText {
+	switch b := b.(type) {
+	case *notion.ParagraphBlock:
+		return b.Paragraph.RichText
+	case *notion.Heading1Block:
+		return b.Heading1.RichText
+	case *notion.Heading2Block:
+		return b.Heading2.RichText
+	case *notion.Heading3Block:
+		return b.Heading3.RichText
+	case *notion.ToDoBlock:
+		return b.ToDo.RichText
+	case *notion.BulletedListItemBlock:
+		return b.BulletedListItem.RichText
+	case *notion.NumberedListItemBlock:
+		return b.NumberedListItem.RichText
+	case *notion.ToggleBlock:
+		return b.Toggle.RichText
+	case *notion.CodeBlock:
+		return b.Code.RichText
+	case *notion.CalloutBlock:
+		return b.Callout.RichText
+	case *notion.QuoteBlock:
+		return b.Quote.RichText
+	default:
+		return nil
+	}
+}
+
+// withRichText returns a shallow copy of the block with its rich text (see
+// BlockRichText) replaced; blocks without rich text are returned as is.
+func withRichText(b notion.Block, rts []notion.RichText) notion.Block {
+	switch b := b.(type) {
+	case *notion.ParagraphBlock:
+		copied := *b
+		copied.Paragraph.RichText = rts
+		return &copied
+	case *notion.Heading1Block:
+		copied := *b
+		copied.Heading1.RichText = rts
+		return &copied
+	case *notion.Heading2Block:
+		copied := *b
+		copied.Heading2.RichText = rts
+		return &copied
+	case *notion.Heading3Block:
+		copied := *b
+		copied.Heading3.RichText = rts
+		return &copied
+	case *notion.ToDoBlock:
+		copied := *b
+		copied.ToDo.RichText = rts
+		return &copied
+	case *notion.BulletedListItemBlock:
+		copied := *b
+		copied.BulletedListItem.RichText = rts
+		return &copied
+	case *notion.NumberedListItemBlock:
+		copied := *b
+		copied.NumberedListItem.RichText = rts
+		return &copied
+	case *notion.ToggleBlock:
+		copied := *b
+		copied.Toggle.RichText = rts
+		return &copied
+	case *notion.CodeBlock:
+		copied := *b
+		copied.Code.RichText = rts
+		return &copied
+	case *notion.CalloutBlock:
+		copied := *b
+		copied.Callout.RichText = rts
+		return &copied
+	case *notion.QuoteBlock:
+		copied := *b
+		copied.Quote.RichText = rts
+		return &copied
+	default:
+		return b
+	}
+}
+
+func RichText2Plain(rts []notion.RichText) string {
+	plain := ""
+	for _, rt := range rts {
+		plain += rt.PlainText
+	}
+	return plain
+}
+
+func PageTitle(page *notion.Page) string {
+	for _, prop := range page.Properties {
+		if title, ok := prop.(*notion.TitleProperty); ok {
+			return RichText2Plain(title.Title)
+		}
+	}
+	return ""
+}
+
+func FileURL(fileType notion.FileType, file, external *notion.FileObject) string {
+	if fileType == "external" && external != nil {
+		return external.URL
+	} else if fileType == "file" && file != nil {
+		return file.URL
+	}
+	return ""
+}
+
+func PageURL(id string) string {
+	return "https://www.notion.so/" + strings.ReplaceAll(id, "-", "")
+}
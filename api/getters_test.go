@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// countingClient counts the pages of children fetched.
+type countingClient struct {
+	NotionAPI
+	pages int
+}
+
+func (c *countingClient) GetBlockChildren(ctx context.Context, id notion.BlockID, pagination *notion.Pagination) (*notion.GetChildrenResponse, error) {
+	c.pages++
+	return c.NotionAPI.GetBlockChildren(ctx, id, pagination)
+}
+
+func TestLargeStack(t *testing.T) {
+	entries := []notion.Block{}
+	for i := 1; i <= 250; i++ {
+		entries = append(entries, todo(fmt.Sprintf("entry %d", i), false))
+	}
+	f, pageID := newStack(t, entries...)
+	client := &countingClient{NotionAPI: f}
+
+	blocks, err := GetStackEntries(client, pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 250 {
+		t.Fatalf("listed %d entries, want 250", len(blocks))
+	}
+	// the stack itself, then three pages of entries
+	if client.pages != 4 {
+		t.Errorf("fetched %d pages of children, want 4", client.pages)
+	}
+	for i, b := range blocks {
+		if got, want := RichText2Plain(BlockRichText(b)), fmt.Sprintf("entry %d", i+1); got != want {
+			t.Fatalf("entry %d is `%s`, want `%s`", i+1, got, want)
+		}
+	}
+
+	if err := ToggleStack(client, pageID, Selector{Keys: []string{"1", "101", "250"}}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := RmFromStack(client, pageID, Selector{Keys: []string{"100", "200", "201"}}); err != nil {
+		t.Fatal(err)
+	}
+	state := stackState(t, f, pageID)
+	if len(state) != 247 {
+		t.Fatalf("%d entries left, want 247", len(state))
+	}
+	checks := map[int]string{
+		0:   "[x] entry 1",
+		1:   "[ ] entry 2",
+		98:  "[ ] entry 99",
+		99:  "[x] entry 101",
+		197: "[ ] entry 199",
+		198: "[ ] entry 202",
+		246: "[x] entry 250",
+	}
+	for i, want := range checks {
+		if state[i] != want {
+			t.Errorf("entry %d is `%s`, want `%s`", i+1, state[i], want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/haykh/nogo/config"
+
+	notion "github.com/jomei/notionapi"
+)
+
+var rawIDPattern = regexp.MustCompile(`(?i)([0-9a-f]{8}-?[0-9a-f]{4}-?[0-9a-f]{4}-?[0-9a-f]{4}-?[0-9a-f]{12})$`)
+
+func ParseID(ref string) (string, error) {
+	ref = strings.TrimSpace(ref)
+	if u, err := url.Parse(ref); err == nil && u.Host != "" {
+		ref = strings.TrimSuffix(u.Path, "/")
+	}
+	if m := rawIDPattern.FindStringSubmatch(ref); m == nil {
+		return "", fmt.Errorf("`%s` is not a notion page id or url", ref)
+	} else {
+		id := strings.ToLower(strings.ReplaceAll(m[1], "-", ""))
+		return fmt.Sprintf("%s-%s-%s-%s-%s", id[0:8], id[8:12], id[12:16], id[16:20], id[20:]), nil
+	}
+}
+
+// ResolvePageRef accepts a saved alias, a registered stack name, a notion url
+// or a (dashed or undashed) page id.
+func ResolvePageRef(loc_config config.LocalParseTemplate, ref string) (string, error) {
+	if id, ok := loc_config.GetAliases()[ref]; ok {
+		return id, nil
+	}
+	if id, ok := loc_config.GetStacks()[ref]; ok {
+		return id, nil
+	}
+	return ParseID(ref)
+}
+
+func SaveAlias(client NotionAPI, loc_config config.LocalParseTemplate, name, ref string) error {
+	if id, err := ParseID(ref); err != nil {
+		return err
+	} else if page, err := client.GetPage(context.Background(), notion.PageID(id)); err != nil {
+		return fmt.Errorf("failed to get page: %w", err)
+	} else if err := writeConfig(fmt.Sprintf("alias `%s` = %s", name, id), func() error {
+		return loc_config.SetAlias(name, id)
+	}); err != nil {
+		return err
+	} else {
+		return ShowPageTitle(NewRenderContext(client), page)
+	}
+}
@@ -0,0 +1,496 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	notion "github.com/jomei/notionapi"
+	"github.com/russross/blackfriday/v2"
+)
+
+const (
+	appendChunkSize = 100
+	richTextMaxLen  = 2000
+)
+
+var notionLanguages = []string{
+	"abap", "arduino", "bash", "basic", "c", "clojure", "coffeescript", "c++", "c#", "css",
+	"dart", "diff", "docker", "elixir", "elm", "erlang", "flow", "fortran", "f#", "gherkin",
+	"glsl", "go", "graphql", "groovy", "haskell", "html", "java", "javascript", "json", "julia",
+	"kotlin", "latex", "less", "lisp", "livescript", "lua", "makefile", "markdown", "markup", "matlab",
+	"mermaid", "nix", "objective-c", "ocaml", "pascal", "perl", "php", "plain text", "powershell", "prolog",
+	"protobuf", "python", "r", "reason", "ruby", "rust", "sass", "scala", "scheme", "scss",
+	"shell", "sql", "swift", "typescript", "vb.net", "verilog", "vhdl", "visual basic", "webassembly", "xml",
+	"yaml",
+}
+
+var languageAliases = map[string]string{
+	"sh":         "shell",
+	"zsh":        "shell",
+	"console":    "shell",
+	"js":         "javascript",
+	"jsx":        "javascript",
+	"ts":         "typescript",
+	"tsx":        "typescript",
+	"py":         "python",
+	"rb":         "ruby",
+	"rs":         "rust",
+	"golang":     "go",
+	"cpp":        "c++",
+	"cxx":        "c++",
+	"cs":         "c#",
+	"csharp":     "c#",
+	"fsharp":     "f#",
+	"yml":        "yaml",
+	"md":         "markdown",
+	"tex":        "latex",
+	"dockerfile": "docker",
+	"make":       "makefile",
+	"text":       "plain text",
+	"txt":        "plain text",
+	"plaintext":  "plain text",
+}
+
+func notionLanguage(info string) string {
+	lang := strings.ToLower(strings.TrimSpace(strings.SplitN(strings.TrimSpace(info), " ", 2)[0]))
+	if alias, ok := languageAliases[lang]; ok {
+		lang = alias
+	}
+	for _, known := range notionLanguages {
+		if lang == known {
+			return lang
+		}
+	}
+	return "plain text"
+}
+
+// importBlock is a block to be appended together with its children, which
+// are appended in separate requests once the parent has an id.
+type importBlock struct {
+	block    notion.Block
+	children []importBlock
+}
+
+type inlineStyle struct {
+	bold, italic, strike, code bool
+	link                       string
+}
+
+func appendText(rts []notion.RichText, content string, style inlineStyle) []notion.RichText {
+	for content != "" {
+		chunk := []rune(content)
+		if len(chunk) > richTextMaxLen {
+			chunk = chunk[:richTextMaxLen]
+		}
+		content = content[len(string(chunk)):]
+		rt := notion.RichText{
+			Type: notion.ObjectTypeText,
+			Text: &notion.Text{Content: string(chunk)},
+			Annotations: &notion.Annotations{
+				Bold:          style.bold,
+				Italic:        style.italic,
+				Strikethrough: style.strike,
+				Code:          style.code,
+				Color:         notion.ColorDefault,
+			},
+		}
+		if style.link != "" {
+			rt.Text.Link = &notion.Link{Url: style.link}
+		}
+		rts = append(rts, rt)
+	}
+	return rts
+}
+
+func inline2RichText(node *blackfriday.Node, style inlineStyle, rts []notion.RichText) []notion.RichText {
+	for child := node.FirstChild; child != nil; child = child.Next {
+		switch child.Type {
+		case blackfriday.Text, blackfriday.HTMLSpan:
+			// blackfriday keeps soft line breaks inside the text literal
+			rts = appendText(rts, strings.ReplaceAll(string(child.Literal), "\n", " "), style)
+		case blackfriday.Code:
+			s := style
+			s.code = true
+			rts = appendText(rts, string(child.Literal), s)
+		case blackfriday.Softbreak:
+			rts = appendText(rts, " ", style)
+		case blackfriday.Hardbreak:
+			rts = appendText(rts, "\n", style)
+		case blackfriday.Emph:
+			s := style
+			s.italic = true
+			rts = inline2RichText(child, s, rts)
+		case blackfriday.Strong:
+			s := style
+			s.bold = true
+			rts = inline2RichText(child, s, rts)
+		case blackfriday.Del:
+			s := style
+			s.strike = true
+			rts = inline2RichText(child, s, rts)
+		case blackfriday.Link:
+			s := style
+			s.link = string(child.LinkData.Destination)
+			rts = inline2RichText(child, s, rts)
+		case blackfriday.Image:
+			// images are lifted out into their own blocks
+		default:
+			rts = inline2RichText(child, style, rts)
+		}
+	}
+	return rts
+}
+
+func collectImages(node *blackfriday.Node) []importBlock {
+	images := []importBlock{}
+	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && n.Type == blackfriday.Image {
+			caption := inline2RichText(n, inlineStyle{}, nil)
+			images = append(images, importBlock{block: &notion.ImageBlock{
+				BasicBlock: notion.BasicBlock{Object: notion.ObjectTypeBlock, Type: notion.BlockTypeImage},
+				Image: notion.Image{
+					Type:     "external",
+					External: &notion.FileObject{URL: string(n.LinkData.Destination)},
+					Caption:  caption,
+				},
+			}})
+			return blackfriday.SkipChildren
+		}
+		return blackfriday.GoToNext
+	})
+	return images
+}
+
+func basic(t notion.BlockType) notion.BasicBlock {
+	return notion.BasicBlock{Object: notion.ObjectTypeBlock, Type: t}
+}
+
+func trimTaskMarker(rts []notion.RichText) ([]notion.RichText, bool, bool) {
+	if len(rts) == 0 || rts[0].Text == nil || rts[0].Annotations.Code {
+		return rts, false, false
+	}
+	content := rts[0].Text.Content
+	for _, marker := range []string{"[ ] ", "[x] ", "[X] "} {
+		if strings.HasPrefix(content, marker) {
+			rts[0].Text.Content = strings.TrimPrefix(content, marker)
+			if rts[0].Text.Content == "" {
+				rts = rts[1:]
+			}
+			return rts, true, marker != "[ ] "
+		}
+	}
+	return rts, false, false
+}
+
+func richTextContent(rts []notion.RichText) string {
+	content := ""
+	for _, rt := range rts {
+		if rt.Text != nil {
+			content += rt.Text.Content
+		}
+	}
+	return content
+}
+
+func parseInline(text string) *blackfriday.Node {
+	return blackfriday.New(blackfriday.WithExtensions(
+		blackfriday.NoIntraEmphasis | blackfriday.Autolink | blackfriday.Strikethrough | blackfriday.BackslashLineBreak,
+	)).Parse([]byte(text))
+}
+
+func inlineRichText(text string) []notion.RichText {
+	return inline2RichText(parseInline(text), inlineStyle{}, []notion.RichText{})
+}
+
+var (
+	fencePattern    = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})(.*)$")
+	headingPattern  = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	hrPattern       = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	quotePattern    = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+	listPattern     = regexp.MustCompile(`^( *)([-*+]|\d{1,9}[.)])( +|$)(.*)$`)
+	tableSepPattern = regexp.MustCompile(`^ {0,3}\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	setextPattern   = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+)
+
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func dedent(line string, n int) string {
+	return line[min(n, leadingSpaces(line)):]
+}
+
+func expandTabs(line string) string {
+	indent := ""
+	for i, r := range line {
+		switch r {
+		case ' ':
+			indent += " "
+		case '\t':
+			indent += strings.Repeat(" ", 4-len(indent)%4)
+		default:
+			return indent + line[i:]
+		}
+	}
+	return indent
+}
+
+func isBlockStart(line string) bool {
+	return fencePattern.MatchString(line) || headingPattern.MatchString(line) ||
+		hrPattern.MatchString(line) || quotePattern.MatchString(line) || listPattern.MatchString(line)
+}
+
+func headingBlock(level int, rts []notion.RichText) importBlock {
+	switch level {
+	case 1:
+		return importBlock{block: &notion.Heading1Block{BasicBlock: basic(notion.BlockTypeHeading1), Heading1: notion.Heading{RichText: rts}}}
+	case 2:
+		return importBlock{block: &notion.Heading2Block{BasicBlock: basic(notion.BlockTypeHeading2), Heading2: notion.Heading{RichText: rts}}}
+	default:
+		return importBlock{block: &notion.Heading3Block{BasicBlock: basic(notion.BlockTypeHeading3), Heading3: notion.Heading{RichText: rts}}}
+	}
+}
+
+func paragraphBlocks(text string) []importBlock {
+	doc := parseInline(text)
+	blocks := []importBlock{}
+	if rts := inline2RichText(doc, inlineStyle{}, []notion.RichText{}); strings.TrimSpace(richTextContent(rts)) != "" {
+		blocks = append(blocks, importBlock{block: &notion.ParagraphBlock{BasicBlock: basic(notion.BlockTypeParagraph), Paragraph: notion.Paragraph{RichText: rts}}})
+	}
+	return append(blocks, collectImages(doc)...)
+}
+
+func codeBlock(code, info string) importBlock {
+	return importBlock{block: &notion.CodeBlock{
+		BasicBlock: basic(notion.BlockTypeCode),
+		Code: notion.Code{
+			RichText: appendText([]notion.RichText{}, code, inlineStyle{}),
+			Language: notionLanguage(info),
+		},
+	}}
+}
+
+// leadText splits off the leading paragraph of a container (list item,
+// quote), which becomes the container's own text in notion.
+func leadText(children []importBlock) ([]notion.RichText, []importBlock) {
+	if len(children) > 0 {
+		if p, ok := children[0].block.(*notion.ParagraphBlock); ok {
+			return p.Paragraph.RichText, children[1:]
+		}
+	}
+	return []notion.RichText{}, children
+}
+
+func listItemBlock(marker string, children []importBlock) importBlock {
+	rts, children := leadText(children)
+	if trimmed, isTask, checked := trimTaskMarker(rts); isTask {
+		return importBlock{block: &notion.ToDoBlock{BasicBlock: basic(notion.BlockTypeToDo), ToDo: notion.ToDo{RichText: trimmed, Checked: checked}}, children: children}
+	} else if marker[0] >= '0' && marker[0] <= '9' {
+		return importBlock{block: &notion.NumberedListItemBlock{BasicBlock: basic(notion.BlockTypeNumberedListItem), NumberedListItem: notion.ListItem{RichText: rts}}, children: children}
+	} else {
+		return importBlock{block: &notion.BulletedListItemBlock{BasicBlock: basic(notion.BlockTypeBulletedListItem), BulletedListItem: notion.ListItem{RichText: rts}}, children: children}
+	}
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	cells := []string{}
+	cell := ""
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' && i+1 < len(line) && line[i+1] == '|' {
+			cell += "|"
+			i++
+		} else if line[i] == '|' {
+			cells = append(cells, strings.TrimSpace(cell))
+			cell = ""
+		} else {
+			cell += string(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell))
+}
+
+func tableBlock(header string, rows []string) importBlock {
+	width := len(splitTableRow(header))
+	children := notion.Blocks{}
+	for _, row := range append([]string{header}, rows...) {
+		cells := [][]notion.RichText{}
+		for _, cell := range splitTableRow(row) {
+			if len(cells) < width {
+				cells = append(cells, inlineRichText(cell))
+			}
+		}
+		for len(cells) < width {
+			cells = append(cells, []notion.RichText{})
+		}
+		children = append(children, &notion.TableRowBlock{BasicBlock: basic(notion.BlockTypeTableRowBlock), TableRow: notion.TableRow{Cells: cells}})
+	}
+	// notion creates a table together with its rows, but takes no more than
+	// appendChunkSize of them; the rest are appended like any other children
+	inline := min(len(children), appendChunkSize)
+	rest := []importBlock{}
+	for _, row := range children[inline:] {
+		rest = append(rest, importBlock{block: row})
+	}
+	return importBlock{block: &notion.TableBlock{
+		BasicBlock: basic(notion.BlockTypeTableBlock),
+		Table:      notion.Table{TableWidth: width, HasColumnHeader: true, Children: children[:inline]},
+	}, children: rest}
+}
+
+func parseMarkdownBlocks(lines []string) []importBlock {
+	blocks := []importBlock{}
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			i++
+		} else if m := fencePattern.FindStringSubmatch(line); m != nil {
+			indent, fence := leadingSpaces(line), m[1]
+			code := []string{}
+			for i++; i < len(lines); i++ {
+				if c := fencePattern.FindStringSubmatch(lines[i]); c != nil && c[1][0] == fence[0] && len(c[1]) >= len(fence) && strings.TrimSpace(c[2]) == "" {
+					i++
+					break
+				}
+				code = append(code, dedent(lines[i], indent))
+			}
+			blocks = append(blocks, codeBlock(strings.Join(code, "\n"), m[2]))
+		} else if m := headingPattern.FindStringSubmatch(line); m != nil {
+			blocks = append(blocks, headingBlock(len(m[1]), inlineRichText(m[2])))
+			i++
+		} else if hrPattern.MatchString(line) {
+			blocks = append(blocks, importBlock{block: &notion.DividerBlock{BasicBlock: basic(notion.BlockTypeDivider)}})
+			i++
+		} else if quotePattern.MatchString(line) {
+			inner := []string{}
+			for ; i < len(lines); i++ {
+				if m := quotePattern.FindStringSubmatch(lines[i]); m != nil {
+					inner = append(inner, m[1])
+				} else if strings.TrimSpace(lines[i]) != "" && strings.TrimSpace(inner[len(inner)-1]) != "" && !isBlockStart(lines[i]) {
+					inner = append(inner, lines[i])
+				} else {
+					break
+				}
+			}
+			rts, children := leadText(parseMarkdownBlocks(inner))
+			blocks = append(blocks, importBlock{block: &notion.QuoteBlock{BasicBlock: basic(notion.BlockQuote), Quote: notion.Quote{RichText: rts}}, children: children})
+		} else if m := listPattern.FindStringSubmatch(line); m != nil {
+			content := len(m[1]) + len(m[2]) + len(m[3])
+			if len(m[3]) > 4 || m[4] == "" {
+				content = len(m[1]) + len(m[2]) + 1
+			}
+			item := []string{m[4]}
+			for i++; i < len(lines); i++ {
+				if next := lines[i]; strings.TrimSpace(next) == "" {
+					item = append(item, "")
+				} else if leadingSpaces(next) >= content {
+					item = append(item, dedent(next, content))
+				} else if item[len(item)-1] != "" && !isBlockStart(next) {
+					item = append(item, strings.TrimLeft(next, " "))
+				} else {
+					break
+				}
+			}
+			blocks = append(blocks, listItemBlock(m[2], parseMarkdownBlocks(item)))
+		} else if i+1 < len(lines) && strings.Contains(line, "|") && tableSepPattern.MatchString(lines[i+1]) {
+			header, rows := line, []string{}
+			for i += 2; i < len(lines) && strings.TrimSpace(lines[i]) != "" && strings.Contains(lines[i], "|"); i++ {
+				rows = append(rows, lines[i])
+			}
+			blocks = append(blocks, tableBlock(header, rows))
+		} else if leadingSpaces(line) >= 4 {
+			code := []string{}
+			for ; i < len(lines) && (strings.TrimSpace(lines[i]) == "" || leadingSpaces(lines[i]) >= 4); i++ {
+				code = append(code, dedent(lines[i], 4))
+			}
+			blocks = append(blocks, codeBlock(strings.TrimRight(strings.Join(code, "\n"), "\n"), ""))
+		} else {
+			para := []string{strings.TrimLeft(line, " ")}
+			level := 0
+			for i++; i < len(lines); i++ {
+				next := lines[i]
+				if m := setextPattern.FindStringSubmatch(next); m != nil {
+					level = map[byte]int{'=': 1, '-': 2}[m[1][0]]
+					i++
+					break
+				}
+				if strings.TrimSpace(next) == "" || isBlockStart(next) {
+					break
+				}
+				para = append(para, strings.TrimLeft(next, " "))
+			}
+			if level > 0 {
+				blocks = append(blocks, headingBlock(level, inlineRichText(strings.Join(para, "\n"))))
+			} else {
+				blocks = append(blocks, paragraphBlocks(strings.Join(para, "\n"))...)
+			}
+		}
+	}
+	return blocks
+}
+
+func parseMarkdown(src []byte) []importBlock {
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = expandTabs(line)
+	}
+	return parseMarkdownBlocks(lines)
+}
+
+func appendImportBlocks(client NotionAPI, parent notion.BlockID, blocks []importBlock) error {
+	for start := 0; start < len(blocks); start += appendChunkSize {
+		chunk := blocks[start:min(start+appendChunkSize, len(blocks))]
+		request := &notion.AppendBlockChildrenRequest{Children: notion.Blocks{}}
+		for _, b := range chunk {
+			request.Children = append(request.Children, b.block)
+		}
+		if response, err := client.AppendBlockChildren(context.Background(), parent, request); err != nil {
+			return err
+		} else if len(response.Results) != len(chunk) {
+			return fmt.Errorf("expected %d appended blocks, got %d", len(chunk), len(response.Results))
+		} else {
+			for i, b := range chunk {
+				if len(b.children) > 0 {
+					if err := appendImportBlocks(client, response.Results[i].GetID(), b.children); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func ImportMarkdown(client NotionAPI, parentID, path, title string, into bool) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	blocks := parseMarkdown(src)
+	target := parentID
+	if !into {
+		if len(blocks) > 0 && title == "" {
+			if h, ok := blocks[0].block.(*notion.Heading1Block); ok {
+				title = richTextContent(h.Heading1.RichText)
+				blocks = blocks[1:]
+			}
+		}
+		if title == "" {
+			title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		if pageID, err := CreatePage(client, parentID, title, ""); err != nil {
+			return fmt.Errorf("failed to create page: %w", err)
+		} else {
+			target = pageID
+		}
+	}
+	return appendImportBlocks(client, notion.BlockID(target), blocks)
+}
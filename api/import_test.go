@@ -0,0 +1,161 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// outline lists the parsed blocks one per line as `type: text`, children
+// indented by two spaces.
+func outline(blocks []importBlock, depth int) []string {
+	lines := []string{}
+	for _, b := range blocks {
+		var line string
+		switch block := b.block.(type) {
+		case *notion.ToDoBlock:
+			line = fmt.Sprintf("to_do %v: %s", block.ToDo.Checked, richTextContent(block.ToDo.RichText))
+		case *notion.CodeBlock:
+			line = fmt.Sprintf("code %s: %s", block.Code.Language, richTextContent(block.Code.RichText))
+		case *notion.ImageBlock:
+			line = fmt.Sprintf("image: %s %s", block.Image.External.URL, richTextContent(block.Image.Caption))
+		case *notion.TableBlock:
+			rows := []string{}
+			for _, row := range block.Table.Children {
+				cells := []string{}
+				for _, cell := range row.(*notion.TableRowBlock).TableRow.Cells {
+					cells = append(cells, richTextContent(cell))
+				}
+				rows = append(rows, strings.Join(cells, "|"))
+			}
+			line = fmt.Sprintf("table %d: %s", block.Table.TableWidth, strings.Join(rows, " / "))
+		default:
+			line = string(b.block.GetType()) + ": " + richTextContent(BlockRichText(b.block))
+		}
+		lines = append(lines, strings.Repeat("  ", depth)+line)
+		lines = append(lines, outline(b.children, depth+1)...)
+	}
+	return lines
+}
+
+func TestParseMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "headings",
+			src:  "# One\n## Two\n### Three\n#### Four ##\nSetext\n======\nSub\n---\n",
+			want: []string{"heading_1: One", "heading_2: Two", "heading_3: Three", "heading_3: Four", "heading_1: Setext", "heading_2: Sub"},
+		},
+		{
+			name: "paragraphs",
+			src:  "one\nline\n\n**bold** and `code`\n\n---\n",
+			want: []string{"paragraph: one line", "paragraph: bold and code", "divider: "},
+		},
+		{
+			name: "nested lists",
+			src:  "- a\n  - b\n    1. c\n    2. d\n- e\n\n1) f\n",
+			want: []string{
+				"bulleted_list_item: a",
+				"  bulleted_list_item: b",
+				"    numbered_list_item: c",
+				"    numbered_list_item: d",
+				"bulleted_list_item: e",
+				"numbered_list_item: f",
+			},
+		},
+		{
+			name: "to-dos",
+			src:  "- [ ] open\n- [x] done\n  - [X] sub-task\n  - plain\n* [ ]\n",
+			want: []string{"to_do false: open", "to_do true: done", "  to_do true: sub-task", "  bulleted_list_item: plain", "bulleted_list_item: [ ]"},
+		},
+		{
+			name: "quotes",
+			src:  "> to be\nor not\n>\n> - to be\n\nafter\n",
+			want: []string{"quote: to be or not", "  bulleted_list_item: to be", "paragraph: after"},
+		},
+		{
+			name: "code",
+			src:  "```py\nprint(1)\n\nprint(2)\n```\n~~~~ cobol\nDISPLAY\n~~~~\n\n    indented\n    code\n",
+			want: []string{"code python: print(1)\n\nprint(2)", "code plain text: DISPLAY", "code plain text: indented\ncode"},
+		},
+		{
+			name: "unterminated fence",
+			src:  "```go\nfmt.Println()\n",
+			want: []string{"code go: fmt.Println()\n"},
+		},
+		{
+			name: "images",
+			src:  "![a cat](https://example.com/cat.png)\n\nsee ![](https://example.com/dog.png) here\n",
+			want: []string{
+				"image: https://example.com/cat.png a cat",
+				"paragraph: see  here",
+				"image: https://example.com/dog.png ",
+			},
+		},
+		{
+			name: "tables",
+			src:  "| name | qty |\n|:-----|----:|\n| milk | 2 |\n| bread |\n| a \\| b | 1 | extra |\n\nafter\n",
+			want: []string{"table 2: name|qty / milk|2 / bread| / a | b|1", "paragraph: after"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := outline(parseMarkdown([]byte(tt.src)), 0); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestImportLargeTable(t *testing.T) {
+	rows := []string{"| n | square |", "|---|---|"}
+	for i := 1; i <= 250; i++ {
+		rows = append(rows, fmt.Sprintf("| %d | %d |", i, i*i))
+	}
+	path := filepath.Join(t.TempDir(), "squares.md")
+	if err := os.WriteFile(path, []byte("# Squares\n\n"+strings.Join(rows, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFakeNotion(t)
+	parent := f.AddPage("", "Notes", "")
+	if err := ImportMarkdown(f, string(parent), path, "", false); err != nil {
+		t.Fatal(err)
+	}
+	pages, err := GetChildren(f, notion.BlockID(parent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || pages[0].GetType() != notion.BlockTypeChildPage {
+		t.Fatalf("got %d blocks under the parent, want the imported page", len(pages))
+	} else if title := pages[0].(*notion.ChildPageBlock).ChildPage.Title; title != "Squares" {
+		t.Errorf("page titled `%s`, want `Squares`", title)
+	}
+	blocks, err := GetChildren(f, pages[0].GetID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || blocks[0].GetType() != notion.BlockTypeTableBlock {
+		t.Fatalf("got %d blocks on the page, want a table", len(blocks))
+	}
+	got, err := GetChildren(f, blocks[0].GetID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 251 {
+		t.Fatalf("table has %d rows, want 251", len(got))
+	}
+	for i, row := range got[1:] {
+		cells := row.(*notion.TableRowBlock).TableRow.Cells
+		if got, want := RichText2Plain(cells[0])+"|"+RichText2Plain(cells[1]), fmt.Sprintf("%d|%d", i+1, (i+1)*(i+1)); got != want {
+			t.Fatalf("row %d is `%s`, want `%s`", i+1, got, want)
+		}
+	}
+}
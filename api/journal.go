@@ -0,0 +1,402 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/haykh/nogo/utils"
+
+	notion "github.com/jomei/notionapi"
+)
+
+type JournalOp string
+
+const (
+	OpAppend JournalOp = "append"
+	OpUpdate JournalOp = "update"
+	OpDelete JournalOp = "delete"
+)
+
+// pendingPrefix marks the ids of blocks appended offline; sync maps them to
+// the ids notion assigns.
+const pendingPrefix = "pending-"
+
+// JournalEntry is a change made while notion was unreachable.
+type JournalEntry struct {
+	Op JournalOp `json:"op"`
+	// PageID is the cached page the change was made on.
+	PageID string `json:"page_id"`
+	// BlockID is the parent of appended blocks, or the updated/deleted block.
+	BlockID notion.BlockID `json:"block_id"`
+	// After is the sibling appended blocks go after, empty for the end.
+	After notion.BlockID `json:"after,omitempty"`
+	// Text is the plain text of the block, to report conflicts with.
+	Text string `json:"text,omitempty"`
+	// LastEditedTime of the block as last seen; sync reports a conflict if the
+	// block was edited remotely after it.
+	LastEditedTime *time.Time                 `json:"last_edited_time,omitempty"`
+	Children       notion.Blocks              `json:"children,omitempty"`
+	Update         *notion.BlockUpdateRequest `json:"update,omitempty"`
+	QueuedAt       time.Time                  `json:"queued_at"`
+}
+
+type Journal struct {
+	path    string
+	Entries []JournalEntry `json:"entries"`
+}
+
+func LoadJournal() (*Journal, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{path: filepath.Join(dir, "journal.json")}
+	if data, err := os.ReadFile(j.path); err != nil {
+		if os.IsNotExist(err) {
+			return j, nil
+		}
+		return nil, err
+	} else if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("corrupt journal %s: %w", j.path, err)
+	}
+	return j, nil
+}
+
+func (j *Journal) Save() error {
+	if len(j.Entries) == 0 {
+		if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if data, err := json.MarshalIndent(j, "", "  "); err != nil {
+		return err
+	} else if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return err
+	} else {
+		return os.WriteFile(j.path, data, 0600)
+	}
+}
+
+func (j *Journal) Add(entry JournalEntry) error {
+	entry.QueuedAt = time.Now()
+	if entry.Op == OpAppend && isPending(entry.BlockID) {
+		for _, e := range j.Entries {
+			for _, b := range e.Children {
+				if b.GetID() == entry.BlockID {
+					basicBlock(b).HasChildren = true
+				}
+			}
+		}
+	}
+	j.Entries = append(j.Entries, entry)
+	return j.Save()
+}
+
+// unreachable reports whether the request never got an answer from notion
+// (no network, dns failure), as opposed to notion rejecting it. Running out
+// of --timeout is a failure, not a reason to queue the change.
+func unreachable(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+func isPending(id notion.BlockID) bool {
+	return strings.HasPrefix(string(id), pendingPrefix)
+}
+
+// applyUpdate returns a copy of the block with the journaled update applied;
+// only the to-do updates made by stack commands are replayed locally.
+func applyUpdate(b notion.Block, request *notion.BlockUpdateRequest) notion.Block {
+	todo, ok := b.(*notion.ToDoBlock)
+	if !ok || request.ToDo == nil {
+		return b
+	}
+	updated := *todo
+	updated.ToDo.RichText = plainRichText(request.ToDo.RichText)
+	updated.ToDo.Checked = request.ToDo.Checked
+	if request.ToDo.Color != "" {
+		updated.ToDo.Color = request.ToDo.Color
+	}
+	return &updated
+}
+
+// plainRichText fills in the plain text notion would return for rich text
+// sent in a request.
+func plainRichText(rts []notion.RichText) []notion.RichText {
+	filled := make([]notion.RichText, len(rts))
+	for i, rt := range rts {
+		if rt.PlainText == "" && rt.Text != nil {
+			rt.PlainText = rt.Text.Content
+		}
+		if rt.Type == "" {
+			rt.Type = notion.ObjectTypeText
+		}
+		if rt.Annotations == nil {
+			rt.Annotations = &notion.Annotations{Color: notion.ColorDefault}
+		}
+		filled[i] = rt
+	}
+	return filled
+}
+
+// Overlay applies the pending changes to the children of a block, as if they
+// had been synced. Appended blocks go after their sibling, or on the last
+// page of children.
+func (j *Journal) Overlay(id notion.BlockID, response *notion.GetChildrenResponse) *notion.GetChildrenResponse {
+	if len(j.Entries) == 0 {
+		return response
+	}
+	overlaid := *response
+	results := append(notion.Blocks{}, response.Results...)
+	for _, e := range j.Entries {
+		switch e.Op {
+		case OpAppend:
+			if e.BlockID != id {
+				continue
+			}
+			at := -1
+			for i, b := range results {
+				if e.After != "" && b.GetID() == e.After {
+					at = i + 1
+				}
+			}
+			if at != -1 {
+				results = append(results[:at:at], append(append(notion.Blocks{}, e.Children...), results[at:]...)...)
+			} else if !response.HasMore {
+				results = append(results, e.Children...)
+			}
+		case OpUpdate:
+			for i, b := range results {
+				if b.GetID() == e.BlockID {
+					results[i] = applyUpdate(b, e.Update)
+				}
+			}
+		case OpDelete:
+			for i, b := range results {
+				if b.GetID() == e.BlockID {
+					results = append(results[:i:i], results[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	overlaid.Results = results
+	return &overlaid
+}
+
+// PendingBlocks builds the blocks appended offline, with ids standing in for
+// the ones notion will assign on sync.
+func PendingBlocks(children []notion.Block) notion.Blocks {
+	now := time.Now()
+	pending := notion.Blocks{}
+	for i, child := range children {
+		if b, err := cloneBlock(child); err == nil {
+			basic := basicBlock(b)
+			basic.ID = notion.BlockID(fmt.Sprintf("%s%d", pendingPrefix, now.UnixNano()+int64(i)))
+			basic.Object = notion.ObjectTypeBlock
+			basic.CreatedTime = &now
+			basic.LastEditedTime = &now
+			if todo, ok := b.(*notion.ToDoBlock); ok {
+				todo.ToDo.RichText = plainRichText(todo.ToDo.RichText)
+			}
+			pending = append(pending, b)
+		}
+	}
+	return pending
+}
+
+// syncState is what a sync run learned about the blocks it wrote.
+type syncState struct {
+	// ids maps the pending ids of blocks appended offline to their real ones.
+	ids map[notion.BlockID]notion.BlockID
+	// edited is the last edit of each block written, as notion answered: the
+	// edits of this run are not remote changes to later entries of the block.
+	edited map[notion.BlockID]time.Time
+}
+
+func newSyncState() *syncState {
+	return &syncState{ids: map[notion.BlockID]notion.BlockID{}, edited: map[notion.BlockID]time.Time{}}
+}
+
+func (s *syncState) wrote(b notion.Block) {
+	if b != nil && b.GetLastEditedTime() != nil {
+		s.edited[b.GetID()] = *b.GetLastEditedTime()
+	}
+}
+
+// rebase points entries left for a later sync at the blocks this run created
+// in place of their pending ones, and at what it saw of the blocks it wrote.
+func (s *syncState) rebase(entries []JournalEntry) []JournalEntry {
+	for i, e := range entries {
+		if real, ok := s.ids[e.BlockID]; ok {
+			entries[i].BlockID = real
+		}
+		if edited, ok := s.edited[entries[i].BlockID]; ok && e.Op != OpAppend {
+			entries[i].LastEditedTime = &edited
+		}
+		if real, ok := s.ids[e.After]; ok {
+			entries[i].After = real
+		}
+	}
+	return entries
+}
+
+// syncEntry replays a journaled change; it returns a description of the
+// conflict instead if the block was changed remotely since it was queued (or
+// since this run last wrote it).
+func syncEntry(client NotionAPI, e JournalEntry, state *syncState, force bool) (string, error) {
+	ctx := context.Background()
+	target := e.BlockID
+	if real, ok := state.ids[target]; ok {
+		target = real
+	} else if isPending(target) {
+		return "its entry was not synced", nil
+	}
+	if e.Op != OpAppend && !force && !isPending(e.BlockID) {
+		seen := e.LastEditedTime
+		if edited, ok := state.edited[target]; ok {
+			seen = &edited
+		}
+		if remote, err := client.GetBlock(ctx, target); err != nil {
+			if unreachable(err) {
+				return "", err
+			}
+			return "removed remotely", nil
+		} else if remote.GetArchived() {
+			return "removed remotely", nil
+		} else if edited := remote.GetLastEditedTime(); seen != nil && edited != nil && edited.After(*seen) {
+			return "changed remotely on " + edited.Local().Format("Jan 2, 2006 15:04"), nil
+		} else {
+			ctx = withBefore(ctx, remote)
+		}
+	}
+	switch e.Op {
+	case OpAppend:
+		pending := []notion.BlockID{}
+		children := []notion.Block{}
+		for _, child := range e.Children {
+			if blank, err := blankBlock(child); err != nil {
+				return "", err
+			} else {
+				pending = append(pending, child.GetID())
+				children = append(children, blank)
+			}
+		}
+		after := e.After
+		if real, ok := state.ids[after]; ok {
+			after = real
+		} else if isPending(after) {
+			return "its sibling was not synced", nil
+		}
+		if response, err := client.AppendBlockChildren(ctx, target, &notion.AppendBlockChildrenRequest{After: after, Children: children}); err != nil {
+			return "", err
+		} else {
+			for i, b := range response.Results {
+				if i < len(pending) {
+					state.ids[pending[i]] = b.GetID()
+				}
+				state.wrote(b)
+			}
+		}
+	case OpUpdate:
+		if block, err := client.UpdateBlock(ctx, target, e.Update); err != nil {
+			return "", err
+		} else {
+			state.wrote(block)
+		}
+	case OpDelete:
+		if _, err := client.DeleteBlock(ctx, target); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+func describeEntry(e JournalEntry) string {
+	switch e.Op {
+	case OpAppend:
+		texts := []string{}
+		for _, child := range e.Children {
+			texts = append(texts, RichText2Plain(BlockRichText(child)))
+		}
+		return fmt.Sprintf("add `%s`", strings.Join(texts, "`, `"))
+	default:
+		return fmt.Sprintf("%s `%s`", e.Op, e.Text)
+	}
+}
+
+// dropCaches drops the cached snapshots of the pages changes were synced to,
+// which lack the blocks the journal no longer overlays.
+func dropCaches(pages map[string]bool) error {
+	for pageID := range pages {
+		if err := DropCache(pageID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync replays the journal in order. Changes to blocks edited remotely in the
+// meantime are reported and kept for later, unless force applies them anyway
+// or discard drops them.
+func Sync(client NotionAPI, force, discard bool) error {
+	j, err := LoadJournal()
+	if err != nil {
+		return err
+	}
+	if len(j.Entries) == 0 {
+		fmt.Println("nothing to sync")
+		return nil
+	}
+	state := newSyncState()
+	kept := []JournalEntry{}
+	synced := 0
+	pages := map[string]bool{}
+	for i, e := range j.Entries {
+		if conflict, err := syncEntry(client, e, state, force); err != nil {
+			if DryRun {
+				return err
+			}
+			j.Entries = state.rebase(append(kept, j.Entries[i:]...))
+			if err := j.Save(); err != nil {
+				return err
+			} else if err := dropCaches(pages); err != nil {
+				return err
+			}
+			return fmt.Errorf("synced %d change(s), failed on %s: %w", synced, describeEntry(e), err)
+		} else if conflict != "" {
+			action := "kept"
+			if discard {
+				action = "dropped"
+			} else {
+				kept = append(kept, e)
+			}
+			fmt.Printf("%s! %s%s: %s (%s)\n", utils.ColorRed, describeEntry(e), utils.ColorReset, conflict, action)
+		} else {
+			synced++
+			pages[e.PageID] = true
+		}
+	}
+	if DryRun {
+		return nil
+	}
+	j.Entries = state.rebase(kept)
+	if err := j.Save(); err != nil {
+		return err
+	} else if err := dropCaches(pages); err != nil {
+		return err
+	}
+	fmt.Printf("%s✓ synced %d change(s)%s\n", utils.ColorGreen, synced, utils.ColorReset)
+	if len(kept) > 0 {
+		fmt.Printf("%d conflicting change(s) left, rerun with --force to apply or --discard to drop them\n", len(kept))
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// offlineStack caches the stack of a fake notion and returns a client working
+// from that cache alone, as with --offline.
+func offlineStack(t *testing.T, entries ...notion.Block) (*FakeNotion, NotionAPI, string) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	f, pageID := newStack(t, entries...)
+	if online, err := NewCacheClient(f, pageID); err != nil {
+		t.Fatal(err)
+	} else if _, err := GetStackEntries(online, pageID); err != nil {
+		t.Fatal(err)
+	} else if err := SaveCache(); err != nil {
+		t.Fatal(err)
+	}
+	defer func(offline bool) { Offline = offline }(Offline)
+	Offline = true
+	client, err := NewCacheClient(f, pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, client, pageID
+}
+
+func journalEntries(t *testing.T) []JournalEntry {
+	t.Helper()
+	j, err := LoadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j.Entries
+}
+
+func checkStack(t *testing.T, client NotionAPI, pageID string, want ...string) {
+	t.Helper()
+	if got := stackState(t, client, pageID); !reflect.DeepEqual(got, want) {
+		t.Errorf("got stack\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestOfflineQueue(t *testing.T) {
+	f, client, pageID := offlineStack(t, todo("buy milk", false), todo("call alice", false))
+	if err := AddToStack(client, pageID, "call bob", nil); err != nil {
+		t.Fatal(err)
+	} else if err := ToggleStack(client, pageID, Selector{Keys: []string{"1"}}, false); err != nil {
+		t.Fatal(err)
+	} else if err := ModifyStack(client, pageID, Selector{Keys: []string{"1"}}, "buy oat milk", nil); err != nil {
+		t.Fatal(err)
+	} else if err := RmFromStack(client, pageID, Selector{Match: []string{"alice"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(journalEntries(t)); got != 4 {
+		t.Errorf("queued %d changes, want 4", got)
+	}
+	// shown merged into the cached stack, and not sent yet
+	checkStack(t, client, pageID, "[x] buy oat milk", "[ ] call bob")
+	checkStack(t, f, pageID, "[ ] buy milk", "[ ] call alice")
+
+	// toggling and then modifying the same entry is not a conflict
+	if err := Sync(f, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if left := journalEntries(t); len(left) != 0 {
+		t.Errorf("%d change(s) left after sync: %+v", len(left), left)
+	}
+	checkStack(t, f, pageID, "[x] buy oat milk", "[ ] call bob")
+}
+
+func TestSyncConflicts(t *testing.T) {
+	f, client, pageID := offlineStack(t, todo("buy milk", false))
+	if err := ModifyStack(client, pageID, Selector{Keys: []string{"1"}}, "buy oat milk", nil); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := GetStackEntries(f, pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.UpdateBlock(context.Background(), blocks[0].GetID(), &notion.BlockUpdateRequest{
+		ToDo: &notion.ToDo{RichText: text("buy soy milk")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Sync(f, false, false); err != nil {
+		t.Fatal(err)
+	}
+	checkStack(t, f, pageID, "[ ] buy soy milk")
+	if got := len(journalEntries(t)); got != 1 {
+		t.Fatalf("kept %d changes, want the conflicting one", got)
+	}
+	if err := Sync(f, true, false); err != nil {
+		t.Fatal(err)
+	}
+	checkStack(t, f, pageID, "[ ] buy oat milk")
+	if got := len(journalEntries(t)); got != 0 {
+		t.Errorf("kept %d changes after --force, want none", got)
+	}
+}
+
+// failOnce fails the first update sent through it.
+type failOnce struct {
+	NotionAPI
+	failed bool
+}
+
+func (c *failOnce) UpdateBlock(ctx context.Context, id notion.BlockID, request *notion.BlockUpdateRequest) (notion.Block, error) {
+	if !c.failed {
+		c.failed = true
+		return nil, &notion.Error{Status: 503, Message: "unavailable"}
+	}
+	return c.NotionAPI.UpdateBlock(ctx, id, request)
+}
+
+func TestSyncFailureKeepsCreatedIDs(t *testing.T) {
+	f, client, pageID := offlineStack(t, todo("buy milk", false))
+	if err := AddToStack(client, pageID, "call bob", nil); err != nil {
+		t.Fatal(err)
+	} else if err := ToggleStack(client, pageID, Selector{Keys: []string{"2"}}, false); err != nil {
+		t.Fatal(err)
+	} else if err := ModifyStack(client, pageID, Selector{Keys: []string{"2"}}, "call bob back", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Sync(&failOnce{NotionAPI: f}, false, false); err == nil || !strings.Contains(err.Error(), "synced 1 change(s), failed on update `call bob`") {
+		t.Fatalf("got %v, want the sync to fail on the toggle", err)
+	}
+	checkStack(t, f, pageID, "[ ] buy milk", "[ ] call bob")
+	left := journalEntries(t)
+	if len(left) != 2 {
+		t.Fatalf("%d change(s) left, want the toggle and the edit", len(left))
+	}
+	for _, e := range left {
+		if isPending(e.BlockID) {
+			t.Errorf("change left for pending block %s instead of the one created", e.BlockID)
+		}
+	}
+
+	if err := Sync(f, false, false); err != nil {
+		t.Fatal(err)
+	}
+	checkStack(t, f, pageID, "[ ] buy milk", "[x] call bob back")
+	if left := journalEntries(t); len(left) != 0 {
+		t.Errorf("%d change(s) left after the second sync: %+v", len(left), left)
+	}
+}
+
+// unreachableWrites fails every write as if notion could not be reached.
+type unreachableWrites struct {
+	NotionAPI
+}
+
+func (unreachableWrites) AppendBlockChildren(context.Context, notion.BlockID, *notion.AppendBlockChildrenRequest) (*notion.AppendBlockChildrenResponse, error) {
+	return nil, &url.Error{Op: "Patch", URL: notionURL, Err: errors.New("no route to host")}
+}
+
+func TestQueueWhenUnreachable(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	f, pageID := newStack(t, todo("buy milk", false))
+	client, err := NewCacheClient(unreachableWrites{f}, pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStack(t, client, pageID, "[ ] buy milk")
+	if err := AddToStack(client, pageID, "call bob", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !isOffline(client) {
+		t.Error("the client does not report notion unreachable")
+	}
+	checkStack(t, client, pageID, "[ ] buy milk", "[ ] call bob")
+	if err := Sync(f, false, false); err != nil {
+		t.Fatal(err)
+	}
+	checkStack(t, f, pageID, "[ ] buy milk", "[ ] call bob")
+}
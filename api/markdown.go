@@ -0,0 +1,393 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	notion "github.com/jomei/notionapi"
+)
+
+type MarkdownRenderer struct {
+	Client NotionAPI
+	// PageLink maps a page or database id to the link target written for it.
+	PageLink func(id string) string
+	// Asset maps a notion-hosted file of a block to the link target written for it.
+	Asset func(blockID, url string) (string, error)
+}
+
+func NewMarkdownRenderer(client NotionAPI) *MarkdownRenderer {
+	return &MarkdownRenderer{Client: client}
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"[", `\[`,
+	"]", `\]`,
+	"<", `\<`,
+	">", `\>`,
+	"~", `\~`,
+	"|", `\|`,
+)
+
+func codeSpan(s string) string {
+	ticks := "`"
+	for strings.Contains(s, ticks) {
+		ticks += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		return ticks + " " + s + " " + ticks
+	}
+	return ticks + s + ticks
+}
+
+func codeFence(s string) string {
+	fence := "```"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	return fence
+}
+
+func splitSpaces(s string) (string, string, string) {
+	core := strings.TrimSpace(s)
+	if core == "" {
+		return s, "", ""
+	}
+	start := strings.Index(s, core)
+	return s[:start], core, s[start+len(core):]
+}
+
+func richTextLink(rt notion.RichText) string {
+	if rt.Text != nil && rt.Text.Link != nil && rt.Text.Link.Url != "" {
+		return rt.Text.Link.Url
+	}
+	return rt.Href
+}
+
+func isNotionLink(url string) bool {
+	return strings.HasPrefix(url, "/") || strings.Contains(url, "notion.so/") || strings.Contains(url, "notion.site/")
+}
+
+func (r *MarkdownRenderer) pageLink(id string) string {
+	if r.PageLink != nil {
+		return r.PageLink(id)
+	}
+	return PageURL(id)
+}
+
+func (r *MarkdownRenderer) link(url string) string {
+	if r.PageLink != nil && isNotionLink(url) {
+		if id, err := ParseID(strings.SplitN(url, "#", 2)[0]); err == nil {
+			return r.PageLink(id)
+		}
+	}
+	return url
+}
+
+func (r *MarkdownRenderer) asset(blockID notion.BlockID, fileType notion.FileType, url string) (string, error) {
+	if r.Asset != nil && fileType == "file" && url != "" {
+		return r.Asset(string(blockID), url)
+	}
+	return url, nil
+}
+
+func (r *MarkdownRenderer) RichText(rts []notion.RichText) string {
+	if r.Client != nil {
+		rts = ResolveMentions(r.Client, rts)
+	}
+	result := ""
+	for _, rt := range rts {
+		var text string
+		code := rt.Annotations != nil && rt.Annotations.Code
+		switch {
+		case rt.Type == "equation":
+			text = "$" + strings.TrimSpace(rt.PlainText) + "$"
+		case code:
+			text = rt.PlainText
+		default:
+			text = markdownEscaper.Replace(rt.PlainText)
+		}
+		lead, core, trail := splitSpaces(text)
+		if core == "" {
+			result += text
+			continue
+		}
+		if code {
+			core = codeSpan(core)
+		}
+		if rt.Annotations != nil {
+			if rt.Annotations.Strikethrough {
+				core = "~~" + core + "~~"
+			}
+			if rt.Annotations.Italic {
+				core = "*" + core + "*"
+			}
+			if rt.Annotations.Bold {
+				core = "**" + core + "**"
+			}
+		}
+		if link := richTextLink(rt); link != "" {
+			core = "[" + core + "](" + r.link(link) + ")"
+		}
+		result += lead + core + trail
+	}
+	return strings.ReplaceAll(result, "\n", "  \n")
+}
+
+func indentLines(s string, prefix string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func prefixLines(s string, first, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if i == 0 {
+			lines[i] = first + line
+		} else if line != "" {
+			lines[i] = rest + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func quoteLines(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = ">"
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func listKind(t notion.BlockType) string {
+	switch t {
+	case notion.BlockTypeBulletedListItem, notion.BlockTypeToDo, notion.BlockTypeToggle:
+		return "bullet"
+	case notion.BlockTypeNumberedListItem:
+		return "ordered"
+	default:
+		return ""
+	}
+}
+
+func (r *MarkdownRenderer) children(b notion.Block) (string, error) {
+	if !b.GetHasChildren() {
+		return "", nil
+	}
+	if children, err := GetChildren(r.Client, b.GetID()); err != nil {
+		return "", err
+	} else {
+		return r.Blocks(children)
+	}
+}
+
+func (r *MarkdownRenderer) Blocks(blocks notion.Blocks) (string, error) {
+	result := ""
+	prevKind := ""
+	counter := 0
+	for _, b := range blocks {
+		kind := listKind(b.GetType())
+		if b.GetType() == notion.BlockTypeNumberedListItem {
+			counter++
+		} else {
+			counter = 0
+		}
+		if md, err := r.Block(b, counter); err != nil {
+			return "", err
+		} else if md != "" {
+			if result != "" {
+				if kind != "" && kind == prevKind {
+					result += "\n"
+				} else {
+					result += "\n\n"
+				}
+			}
+			result += md
+			prevKind = kind
+		}
+	}
+	return result, nil
+}
+
+func (r *MarkdownRenderer) listItem(b notion.Block, marker string, rts []notion.RichText) (string, error) {
+	pad := strings.Repeat(" ", len([]rune(marker)))
+	result := prefixLines(r.RichText(rts), marker, pad)
+	if children, err := r.children(b); err != nil {
+		return "", err
+	} else if children != "" {
+		result += "\n" + indentLines(children, pad)
+	}
+	return result, nil
+}
+
+func (r *MarkdownRenderer) withChildren(b notion.Block, md string) (string, error) {
+	if children, err := r.children(b); err != nil {
+		return "", err
+	} else if children != "" {
+		if md == "" {
+			return children, nil
+		}
+		return md + "\n\n" + children, nil
+	}
+	return md, nil
+}
+
+func (r *MarkdownRenderer) linkOrURL(caption []notion.RichText, url string) string {
+	if url == "" {
+		return ""
+	}
+	text := r.RichText(caption)
+	if text == "" {
+		text = markdownEscaper.Replace(url)
+	}
+	return fmt.Sprintf("[%s](%s)", text, url)
+}
+
+func (r *MarkdownRenderer) table(b *notion.TableBlock) (string, error) {
+	rows, err := GetChildren(r.Client, b.GetID())
+	if err != nil {
+		return "", err
+	}
+	lines := []string{}
+	for i, row := range rows {
+		tr, ok := row.(*notion.TableRowBlock)
+		if !ok {
+			continue
+		}
+		cells := []string{}
+		for c := 0; c < b.Table.TableWidth; c++ {
+			cell := ""
+			if c < len(tr.TableRow.Cells) {
+				cell = strings.ReplaceAll(r.RichText(tr.TableRow.Cells[c]), "  \n", " ")
+			}
+			cells = append(cells, cell)
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", b.Table.TableWidth))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (r *MarkdownRenderer) Block(b notion.Block, number int) (string, error) {
+	switch b := b.(type) {
+	case *notion.Heading1Block:
+		return r.withChildren(b, "# "+r.RichText(b.Heading1.RichText))
+	case *notion.Heading2Block:
+		return r.withChildren(b, "## "+r.RichText(b.Heading2.RichText))
+	case *notion.Heading3Block:
+		return r.withChildren(b, "### "+r.RichText(b.Heading3.RichText))
+	case *notion.ParagraphBlock:
+		return r.withChildren(b, r.RichText(b.Paragraph.RichText))
+	case *notion.BulletedListItemBlock:
+		return r.listItem(b, "- ", b.BulletedListItem.RichText)
+	case *notion.NumberedListItemBlock:
+		return r.listItem(b, fmt.Sprintf("%d. ", number), b.NumberedListItem.RichText)
+	case *notion.ToDoBlock:
+		if b.ToDo.Checked {
+			return r.listItem(b, "- [x] ", b.ToDo.RichText)
+		}
+		return r.listItem(b, "- [ ] ", b.ToDo.RichText)
+	case *notion.ToggleBlock:
+		return r.listItem(b, "- ", b.Toggle.RichText)
+	case *notion.QuoteBlock:
+		if md, err := r.withChildren(b, r.RichText(b.Quote.RichText)); err != nil {
+			return "", err
+		} else {
+			return quoteLines(md), nil
+		}
+	case *notion.CalloutBlock:
+		text := r.RichText(b.Callout.RichText)
+		if b.Callout.Icon != nil && b.Callout.Icon.Emoji != nil {
+			text = string(*b.Callout.Icon.Emoji) + " " + text
+		}
+		if md, err := r.withChildren(b, text); err != nil {
+			return "", err
+		} else {
+			return quoteLines(md), nil
+		}
+	case *notion.CodeBlock:
+		code := RichText2Plain(b.Code.RichText)
+		lang := b.Code.Language
+		if lang == "plain text" {
+			lang = ""
+		}
+		fence := codeFence(code)
+		return fence + strings.ReplaceAll(lang, " ", "") + "\n" + code + "\n" + fence, nil
+	case *notion.EquationBlock:
+		return "$$\n" + strings.TrimSpace(b.Equation.Expression) + "\n$$", nil
+	case *notion.DividerBlock:
+		return "---", nil
+	case *notion.ImageBlock:
+		if url, err := r.asset(b.ID, b.Image.Type, FileURL(b.Image.Type, b.Image.File, b.Image.External)); err != nil {
+			return "", err
+		} else {
+			alt := strings.ReplaceAll(RichText2Plain(b.Image.Caption), "\n", " ")
+			return fmt.Sprintf("![%s](%s)", markdownEscaper.Replace(alt), url), nil
+		}
+	case *notion.VideoBlock:
+		return r.linkOrURL(b.Video.Caption, FileURL(b.Video.Type, b.Video.File, b.Video.External)), nil
+	case *notion.AudioBlock:
+		return r.linkOrURL(b.Audio.Caption, FileURL(b.Audio.Type, b.Audio.File, b.Audio.External)), nil
+	case *notion.FileBlock:
+		return r.linkOrURL(b.File.Caption, FileURL(b.File.Type, b.File.File, b.File.External)), nil
+	case *notion.PdfBlock:
+		return r.linkOrURL(b.Pdf.Caption, FileURL(b.Pdf.Type, b.Pdf.File, b.Pdf.External)), nil
+	case *notion.BookmarkBlock:
+		return r.linkOrURL(b.Bookmark.Caption, b.Bookmark.URL), nil
+	case *notion.EmbedBlock:
+		return r.linkOrURL(b.Embed.Caption, b.Embed.URL), nil
+	case *notion.LinkPreviewBlock:
+		return r.linkOrURL(nil, b.LinkPreview.URL), nil
+	case *notion.ChildPageBlock:
+		return fmt.Sprintf("[%s](%s)", markdownEscaper.Replace(b.ChildPage.Title), r.pageLink(string(b.ID))), nil
+	case *notion.ChildDatabaseBlock:
+		return fmt.Sprintf("[%s](%s)", markdownEscaper.Replace(b.ChildDatabase.Title), r.pageLink(string(b.ID))), nil
+	case *notion.LinkToPageBlock:
+		id := string(b.LinkToPage.PageID)
+		if id == "" {
+			id = string(b.LinkToPage.DatabaseID)
+		}
+		return r.linkOrURL(nil, r.pageLink(id)), nil
+	case *notion.TableBlock:
+		return r.table(b)
+	case *notion.ColumnListBlock, *notion.ColumnBlock, *notion.SyncedBlock, *notion.TemplateBlock:
+		return r.children(b)
+	default:
+		return "", nil
+	}
+}
+
+func (r *MarkdownRenderer) Page(pageID string) (string, error) {
+	if page, err := r.Client.GetPage(context.Background(), notion.PageID(pageID)); err != nil {
+		return "", fmt.Errorf("failed to get page: %w", err)
+	} else {
+		if blocks, err := GetChildren(r.Client, notion.BlockID(pageID)); err != nil {
+			return "", fmt.Errorf("failed to get block children: %w", err)
+		} else {
+			if body, err := r.Blocks(blocks); err != nil {
+				return "", err
+			} else {
+				result := "# " + markdownEscaper.Replace(PageTitle(page)) + "\n"
+				if body != "" {
+					result += "\n" + body + "\n"
+				}
+				return result, nil
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// mentionNames caches the resolved titles and user names across a render, so
+// that a page mentioned many times is only fetched once.
+var mentionNames = struct {
+	sync.Mutex
+	names map[string]string
+}{names: map[string]string{}}
+
+func cachedName(key string, fetch func() (string, error)) (string, bool) {
+	mentionNames.Lock()
+	name, ok := mentionNames.names[key]
+	mentionNames.Unlock()
+	if ok {
+		return name, name != ""
+	}
+	name, err := fetch()
+	if err != nil {
+		name = ""
+	}
+	mentionNames.Lock()
+	mentionNames.names[key] = name
+	mentionNames.Unlock()
+	return name, name != ""
+}
+
+// isDateOnly tells all-day dates, which notion returns as midnight UTC, from
+// times; a time with an offset (e.g. 17:00 at -07:00) is never one, even
+// when it falls on midnight UTC.
+func isDateOnly(t time.Time) bool {
+	_, offset := t.Zone()
+	t = t.UTC()
+	return offset == 0 && t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+}
+
+func FormatDate(d *notion.Date) string {
+	t := time.Time(*d)
+	if isDateOnly(t) {
+		return t.UTC().Format("Jan 2, 2006")
+	}
+	return t.Local().Format("Jan 2, 2006 15:04")
+}
+
+func mentionDate(date *notion.DateObject) string {
+	if date == nil || date.Start == nil {
+		return ""
+	}
+	text := FormatDate(date.Start)
+	if date.End != nil {
+		text += " → " + FormatDate(date.End)
+	}
+	return text
+}
+
+// ResolveMentions returns a copy of the rich text with the plain text of
+// page, database, user and date mentions rewritten: pages and databases get
+// their current title, users their name and dates are formatted in local time.
+// The spans passed in are left untouched, as they may be shared with the
+// cache or sent back to notion. Mentions that cannot be resolved (e.g. pages
+// not shared with the integration) keep the text notion sent along.
+func ResolveMentions(client NotionAPI, rts []notion.RichText) []notion.RichText {
+	rts = append([]notion.RichText(nil), rts...)
+	for i := range rts {
+		mention := rts[i].Mention
+		if rts[i].Type != "mention" || mention == nil {
+			continue
+		}
+		switch {
+		case mention.Page != nil:
+			id := string(mention.Page.ID)
+			if title, ok := cachedName("page:"+id, func() (string, error) {
+				if page, err := client.GetPage(context.Background(), notion.PageID(id)); err != nil {
+					return "", err
+				} else {
+					return PageTitle(page), nil
+				}
+			}); ok {
+				rts[i].PlainText = title
+			}
+			if rts[i].Href == "" {
+				rts[i].Href = PageURL(id)
+			}
+		case mention.Database != nil:
+			id := string(mention.Database.ID)
+			if title, ok := cachedName("database:"+id, func() (string, error) {
+				if db, err := client.GetDatabase(context.Background(), notion.DatabaseID(id)); err != nil {
+					return "", err
+				} else {
+					return RichText2Plain(db.Title), nil
+				}
+			}); ok {
+				rts[i].PlainText = title
+			}
+			if rts[i].Href == "" {
+				rts[i].Href = PageURL(id)
+			}
+		case mention.User != nil:
+			name := mention.User.Name
+			if name == "" {
+				name, _ = cachedName("user:"+string(mention.User.ID), func() (string, error) {
+					if user, err := client.GetUser(context.Background(), mention.User.ID); err != nil {
+						return "", err
+					} else {
+						return user.Name, nil
+					}
+				})
+			}
+			if name != "" {
+				rts[i].PlainText = "@" + name
+			}
+		case mention.Date != nil:
+			if date := mentionDate(mention.Date); date != "" {
+				rts[i].PlainText = date
+			}
+		}
+	}
+	return rts
+}
@@ -0,0 +1,355 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	notion "github.com/jomei/notionapi"
+)
+
+type Priority int
+
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
+var priorityNames = map[string]Priority{
+	"low":    PriorityLow,
+	"med":    PriorityMedium,
+	"medium": PriorityMedium,
+	"high":   PriorityHigh,
+}
+
+var priorityColors = map[Priority]notion.Color{
+	PriorityLow:    notion.ColorBlue,
+	PriorityMedium: notion.ColorYellow,
+	PriorityHigh:   notion.ColorRed,
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityMedium:
+		return "medium"
+	case PriorityHigh:
+		return "high"
+	default:
+		return ""
+	}
+}
+
+const tagColor = notion.ColorPurple
+
+var (
+	tokenPattern    = regexp.MustCompile(`\S+`)
+	duePattern      = regexp.MustCompile(`^@due\(([^)]*)\)$`)
+	priorityPattern = regexp.MustCompile(`^!(high|medium|med|low)$`)
+	tagPattern      = regexp.MustCompile(`^#([\p{L}\p{N}_/-]+)$`)
+)
+
+var dueLayouts = []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02 15:04", time.RFC3339}
+
+// ParseDue reads a due date as written in `@due(...)`: a date, or a date and
+// time in local time (RFC 3339 with an explicit offset also works). Dates
+// without a time are kept at midnight UTC, which is how they come back from
+// notion.
+func ParseDue(s string) (*notion.Date, error) {
+	return parseDueIn(s, time.Local)
+}
+
+func parseDueIn(s string, local *time.Location) (*notion.Date, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dueLayouts {
+		loc := local
+		if layout == "2006-01-02" {
+			loc = time.UTC
+		}
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			date := notion.Date(t)
+			return &date, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot parse due date `%s` (expected YYYY-MM-DD or YYYY-MM-DDTHH:MM)", s)
+}
+
+func textSpan(text string, color notion.Color) notion.RichText {
+	return notion.RichText{
+		Type:        notion.ObjectTypeText,
+		Text:        &notion.Text{Content: text},
+		PlainText:   text,
+		Annotations: &notion.Annotations{Color: color},
+	}
+}
+
+// DateMention mentions a date; an all-day date (see isDateOnly) is sent and
+// shown without a time.
+func DateMention(date *notion.Date) notion.RichText {
+	plain := date.String()
+	if t := time.Time(*date); isDateOnly(t) {
+		plain = t.Format("2006-01-02")
+	}
+	return notion.RichText{
+		Type: "mention",
+		Mention: &notion.Mention{
+			Type: notion.MentionTypeDate,
+			Date: &notion.DateObject{Start: date},
+		},
+		PlainText:   plain,
+		Annotations: &notion.Annotations{Color: notion.ColorDefault},
+	}
+}
+
+// EntryRichText turns the text of a stack entry into rich text: `@due(date)`
+// (any single-word date ParseNaturalDate understands, e.g. `@due(friday)`)
+// becomes a date mention, `!high`, `!medium` (`!med`) and `!low` are
+// coloured by priority and `#tags` are coloured too.
+func EntryRichText(text string) ([]notion.RichText, error) {
+	rts := []notion.RichText{}
+	plain := ""
+	flush := func() {
+		if plain != "" {
+			rts = append(rts, textSpan(plain, notion.ColorDefault))
+			plain = ""
+		}
+	}
+	last := 0
+	for _, loc := range tokenPattern.FindAllStringIndex(text, -1) {
+		plain += text[last:loc[0]]
+		last = loc[1]
+		token := text[loc[0]:loc[1]]
+		if m := duePattern.FindStringSubmatch(token); m != nil {
+			if date, err := ParseNaturalDate(m[1], Now()); err != nil {
+				return nil, err
+			} else {
+				flush()
+				rts = append(rts, DateMention(date))
+			}
+		} else if m := priorityPattern.FindStringSubmatch(token); m != nil {
+			flush()
+			rts = append(rts, textSpan(token, priorityColors[priorityNames[m[1]]]))
+		} else if tagPattern.MatchString(token) {
+			flush()
+			rts = append(rts, textSpan(token, tagColor))
+		} else {
+			plain += token
+		}
+	}
+	plain += text[last:]
+	flush()
+	return rts, nil
+}
+
+// WithDue replaces the due date of an entry, appending it as a date mention.
+func WithDue(rts []notion.RichText, due *notion.Date) []notion.RichText {
+	dated := []notion.RichText{}
+	for _, rt := range rts {
+		if rt.Mention == nil || rt.Mention.Date == nil {
+			dated = append(dated, rt)
+		}
+	}
+	if n := len(dated); n > 0 && !strings.HasSuffix(dated[n-1].PlainText, " ") {
+		dated = append(dated, textSpan(" ", notion.ColorDefault))
+	}
+	return append(dated, DateMention(due))
+}
+
+// EntryText is the inverse of EntryRichText, for editing an entry.
+func EntryText(rts []notion.RichText) string {
+	text := ""
+	for _, rt := range rts {
+		if rt.Mention != nil && rt.Mention.Date != nil && rt.Mention.Date.Start != nil {
+			start := time.Time(*rt.Mention.Date.Start)
+			if isDateOnly(start) {
+				text += "@due(" + start.UTC().Format("2006-01-02") + ")"
+			} else {
+				text += "@due(" + start.Local().Format("2006-01-02T15:04") + ")"
+			}
+		} else {
+			text += rt.PlainText
+		}
+	}
+	return text
+}
+
+// EntryMeta is what a stack entry says about itself beyond its text.
+type EntryMeta struct {
+	Due      *time.Time
+	Priority Priority
+	Tags     []string
+}
+
+// ParseEntryMeta reads the due date (the first date mention, or an
+// `@due(...)` typed in notion), priority and tags of an entry.
+func ParseEntryMeta(rts []notion.RichText) EntryMeta {
+	meta := EntryMeta{}
+	for _, rt := range rts {
+		if rt.Mention != nil {
+			if rt.Mention.Date != nil && rt.Mention.Date.Start != nil && meta.Due == nil {
+				due := time.Time(*rt.Mention.Date.Start)
+				meta.Due = &due
+			}
+			continue
+		}
+		for _, token := range tokenPattern.FindAllString(rt.PlainText, -1) {
+			if m := duePattern.FindStringSubmatch(token); m != nil && meta.Due == nil {
+				if date, err := ParseDue(m[1]); err == nil {
+					due := time.Time(*date)
+					meta.Due = &due
+				}
+			} else if m := priorityPattern.FindStringSubmatch(token); m != nil {
+				meta.Priority = max(meta.Priority, priorityNames[m[1]])
+			} else if m := tagPattern.FindStringSubmatch(token); m != nil {
+				meta.Tags = append(meta.Tags, strings.ToLower(m[1]))
+			}
+		}
+	}
+	return meta
+}
+
+// Overdue reports whether the entry was due before now; an entry due on a
+// date (without a time) is overdue from the following day on.
+func (m EntryMeta) Overdue(now time.Time) bool {
+	if m.Due == nil {
+		return false
+	}
+	if isDateOnly(*m.Due) {
+		y, mo, d := now.Date()
+		today := time.Date(y, mo, d, 0, 0, 0, 0, time.UTC)
+		return m.Due.UTC().Before(today)
+	}
+	return m.Due.Before(now)
+}
+
+func (m EntryMeta) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == strings.ToLower(strings.TrimPrefix(tag, "#")) {
+			return true
+		}
+	}
+	return false
+}
+
+// StackQuery filters and orders the entries shown by `nogo s` (and narrows
+// the entries `toggle`, `rm` and `mod` act on).
+type StackQuery struct {
+	// Sort is "due", "priority" or empty for the order on the page.
+	Sort string
+	// Tags keeps entries carrying all of them.
+	Tags []string
+	// Overdue keeps unchecked entries past their due date.
+	Overdue bool
+	// Grep keeps entries containing it (case-insensitive).
+	Grep string
+	// Regex keeps entries matching it.
+	Regex string
+	// Fuzzy keeps entries containing its letters in order (case-insensitive).
+	Fuzzy string
+	// Done and Todo keep checked and unchecked entries.
+	Done bool
+	Todo bool
+	// Limit keeps the first entries only, zero for all.
+	Limit int
+}
+
+// IsEmpty reports whether the query filters nothing. Sort and Limit only
+// order and cap the entries a filter matched, so on their own they select
+// nothing for `toggle`, `rm` and `mod`.
+func (q StackQuery) IsEmpty() bool {
+	return len(q.Tags) == 0 && !q.Overdue &&
+		q.Grep == "" && q.Regex == "" && q.Fuzzy == "" && !q.Done && !q.Todo
+}
+
+func (q StackQuery) Validate() error {
+	switch q.Sort {
+	case "", "due", "priority":
+	default:
+		return fmt.Errorf("unknown sort key `%s` (due, priority)", q.Sort)
+	}
+	if _, err := regexp.Compile(q.Regex); err != nil {
+		return fmt.Errorf("invalid regex `%s`: %w", q.Regex, err)
+	} else if q.Done && q.Todo {
+		return errors.New("--done and --todo cannot be combined")
+	} else if q.Limit < 0 {
+		return errors.New("--limit cannot be negative")
+	}
+	return nil
+}
+
+// fuzzyMatch reports whether the letters of pattern appear in text in order,
+// ignoring case and spaces in the pattern.
+func fuzzyMatch(pattern, text string) bool {
+	rest := []rune(strings.ToLower(text))
+	for _, r := range strings.ToLower(pattern) {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		found := false
+		for i, t := range rest {
+			if t == r {
+				rest, found = rest[i+1:], true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether an entry passes the filters of the query.
+func (q StackQuery) matches(e StackEntry, re *regexp.Regexp, now time.Time) bool {
+	meta := EntryMeta{Due: e.Due, Tags: e.Tags}
+	for _, tag := range q.Tags {
+		if !meta.HasTag(tag) {
+			return false
+		}
+	}
+	return (!q.Overdue || (!e.Checked && meta.Overdue(now))) &&
+		(!q.Done || e.Checked) && (!q.Todo || !e.Checked) &&
+		(q.Grep == "" || strings.Contains(strings.ToLower(e.Text), strings.ToLower(q.Grep))) &&
+		(re == nil || re.MatchString(e.Text)) &&
+		(q.Fuzzy == "" || fuzzyMatch(q.Fuzzy, e.Text))
+}
+
+// Apply returns the indices of the entries to show, in order; an invalid
+// regex (see Validate) matches nothing.
+func (q StackQuery) Apply(entries []StackEntry, now time.Time) []int {
+	var re *regexp.Regexp
+	if q.Regex != "" {
+		var err error
+		if re, err = regexp.Compile(q.Regex); err != nil {
+			return []int{}
+		}
+	}
+	selected := []int{}
+	for i, e := range entries {
+		if q.matches(e, re, now) {
+			selected = append(selected, i)
+		}
+	}
+	switch q.Sort {
+	case "due":
+		sort.SliceStable(selected, func(a, b int) bool {
+			da, db := entries[selected[a]].Due, entries[selected[b]].Due
+			return da != nil && (db == nil || da.Before(*db))
+		})
+	case "priority":
+		sort.SliceStable(selected, func(a, b int) bool {
+			return priorityNames[entries[selected[a]].Priority] > priorityNames[entries[selected[b]].Priority]
+		})
+	}
+	if q.Limit > 0 && len(selected) > q.Limit {
+		selected = selected[:q.Limit]
+	}
+	return selected
+}
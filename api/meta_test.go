@@ -0,0 +1,84 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	notion "github.com/jomei/notionapi"
+)
+
+func TestStackDueDates(t *testing.T) {
+	due := notion.Date(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC))
+	runStackTests(t, []stackTest{
+		{
+			name: "add with a due date",
+			run: func(client NotionAPI, pageID string) error {
+				return AddToStack(client, pageID, "pay rent", &due)
+			},
+			want: []string{"[ ] pay rent 2026-11-01"},
+		},
+		{
+			name:    "mod only the due date",
+			entries: []notion.Block{todo("pay rent", false)},
+			run: func(client NotionAPI, pageID string) error {
+				return ModifyStack(client, pageID, Selector{Keys: []string{"1"}}, "", &due)
+			},
+			want: []string{"[ ] pay rent 2026-11-01"},
+		},
+	})
+}
+
+func TestAllDayDueOnTheWire(t *testing.T) {
+	var body atomic.Value
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body.Store(string(data))
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"block","id":"b","type":"to_do","to_do":{"rich_text":[]}}`)
+	}))
+	defer ts.Close()
+	target, _ := url.Parse(ts.URL)
+	client := newClient("secret", redirect{target})
+
+	allDay := notion.Date(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC))
+	timed := notion.Date(time.Date(2026, 11, 1, 17, 30, 0, 0, time.UTC))
+	tests := []struct {
+		name string
+		due  notion.Date
+		want string
+	}{
+		{"all-day", allDay, `"start":"2026-11-01"`},
+		{"timed", timed, `"start":"2026-11-01T17:30:00Z"`},
+	}
+	for _, tt := range tests {
+		rts := WithDue([]notion.RichText{textSpan("pay rent", notion.ColorDefault)}, &tt.due)
+		request := &notion.BlockUpdateRequest{ToDo: &notion.ToDo{RichText: rts}}
+		if _, err := client.UpdateBlock(context.Background(), "b", request); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if sent := body.Load().(string); !strings.Contains(sent, tt.want) {
+			t.Errorf("%s: sent %s, want %s", tt.name, sent, tt.want)
+		}
+		if _, err := client.AppendBlockChildren(context.Background(), "b", &notion.AppendBlockChildrenRequest{
+			Children: []notion.Block{&notion.ToDoBlock{
+				BasicBlock: notion.BasicBlock{Object: notion.ObjectTypeBlock, Type: notion.BlockTypeToDo},
+				ToDo:       notion.ToDo{RichText: rts},
+			}},
+		}); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if sent := body.Load().(string); !strings.Contains(sent, tt.want) {
+			t.Errorf("%s: appended %s, want %s", tt.name, sent, tt.want)
+		}
+	}
+	if plain := DateMention(&allDay).PlainText; plain != "2026-11-01" {
+		t.Errorf("plain text of an all-day date is %s, want 2026-11-01", plain)
+	}
+}
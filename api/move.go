@@ -0,0 +1,302 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/haykh/nogo/utils"
+
+	survey "github.com/AlecAivazis/survey/v2"
+	notion "github.com/jomei/notionapi"
+)
+
+// Placement is where `nogo s move` puts the selected entries; exactly one of
+// the fields is set.
+type Placement struct {
+	Top    bool
+	Bottom bool
+	// After is the index or id of the entry to move them after.
+	After string
+}
+
+func (p Placement) validate() error {
+	set := 0
+	for _, b := range []bool{p.Top, p.Bottom, p.After != ""} {
+		if b {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("expected exactly one of --top, --bottom or --after")
+	}
+	return nil
+}
+
+// blankBlock copies a block for re-creation, without its id, timestamps and
+// other read-only fields.
+func blankBlock(b notion.Block) (notion.Block, error) {
+	if clone, err := cloneBlock(b); err != nil {
+		return nil, err
+	} else {
+		basic := basicBlock(clone)
+		*basic = notion.BasicBlock{Object: notion.ObjectTypeBlock, Type: basic.Type}
+		return clone, nil
+	}
+}
+
+// copyChildren re-creates the children of a block (recursively) under another.
+func copyChildren(client NotionAPI, from, to notion.BlockID) error {
+	children, err := GetChildren(client, from)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(children); start += childrenPageSize {
+		batch := children[start:min(start+childrenPageSize, len(children))]
+		request := &notion.AppendBlockChildrenRequest{}
+		for _, child := range batch {
+			if blank, err := blankBlock(child); err != nil {
+				return err
+			} else {
+				request.Children = append(request.Children, blank)
+			}
+		}
+		response, err := client.AppendBlockChildren(context.Background(), to, request)
+		if err != nil {
+			return err
+		}
+		for i, child := range batch {
+			if child.GetHasChildren() && i < len(response.Results) {
+				if err := copyChildren(client, child.GetID(), response.Results[i].GetID()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// recreate copies a block with its children right after another one (notion
+// cannot move blocks) and returns the id of the copy.
+func recreate(client NotionAPI, parent, after notion.BlockID, b notion.Block) (notion.BlockID, error) {
+	blank, err := blankBlock(b)
+	if err != nil {
+		return "", err
+	}
+	response, err := client.AppendBlockChildren(context.Background(), parent, &notion.AppendBlockChildrenRequest{
+		After:    after,
+		Children: []notion.Block{blank},
+	})
+	if err != nil {
+		return "", err
+	} else if len(response.Results) == 0 {
+		return "", fmt.Errorf("failed to re-create block %s", b.GetID())
+	}
+	id := response.Results[0].GetID()
+	if b.GetHasChildren() {
+		if err := copyChildren(client, b.GetID(), id); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+// staying picks the blocks that keep their place when reordering into target
+// (a permutation of the current positions): the longest run of them already
+// in order. Blocks are only ever inserted after another, so unless the first
+// one stays, it is moved too and serves as the anchor for the ones before the
+// first staying block.
+func staying(target []int) map[int]bool {
+	// longest[i] is the length of the longest increasing run ending at target[i]
+	longest := make([]int, len(target))
+	prev := make([]int, len(target))
+	end := -1
+	for i, v := range target {
+		prev[i] = -1
+		if v == 0 && target[0] != 0 {
+			continue
+		}
+		longest[i] = 1
+		for j := 0; j < i; j++ {
+			if target[j] < v && longest[j]+1 > longest[i] && (target[j] != 0 || target[0] == 0) {
+				longest[i], prev[i] = longest[j]+1, j
+			}
+		}
+		if end == -1 || longest[i] > longest[end] {
+			end = i
+		}
+	}
+	stay := map[int]bool{}
+	for i := end; i != -1; i = prev[i] {
+		stay[target[i]] = true
+	}
+	return stay
+}
+
+// reorder rearranges the children of a block into target order, re-creating
+// as few of them as it can.
+func reorder(client NotionAPI, parent notion.BlockID, blocks notion.Blocks, target []int) error {
+	stay := staying(target)
+	ids := make([]notion.BlockID, len(blocks))
+	for i, b := range blocks {
+		ids[i] = b.GetID()
+	}
+	for pos, idx := range target {
+		if stay[idx] {
+			continue
+		}
+		after := blocks[0].GetID()
+		if pos > 0 {
+			after = ids[target[pos-1]]
+		}
+		if id, err := recreate(client, parent, after, blocks[idx]); err != nil {
+			return err
+		} else if _, err := client.DeleteBlock(context.Background(), blocks[idx].GetID()); err != nil {
+			return err
+		} else {
+			ids[idx] = id
+		}
+	}
+	return nil
+}
+
+// placed moves the selected positions of order (in their order) to the top,
+// the bottom or after the given position.
+func placed(order []int, selected []int, to Placement, after int) []int {
+	moved := []int{}
+	rest := []int{}
+	for _, idx := range order {
+		if utils.IsIn(idx, selected) {
+			moved = append(moved, idx)
+		} else {
+			rest = append(rest, idx)
+		}
+	}
+	switch {
+	case to.Top:
+		return append(moved, rest...)
+	case to.Bottom:
+		return append(rest, moved...)
+	default:
+		target := []int{}
+		for _, idx := range rest {
+			target = append(target, idx)
+			if idx == after {
+				target = append(target, moved...)
+			}
+		}
+		return target
+	}
+}
+
+func unchanged(order []int) bool {
+	for i, idx := range order {
+		if i != idx {
+			return false
+		}
+	}
+	return true
+}
+
+// MoveStack moves the selected entries (with their sub-tasks) to the top,
+// the bottom or after another entry; with no selection it asks for a new
+// order interactively.
+func MoveStack(client NotionAPI, pageID string, sel Selector, to Placement) error {
+	stack, err := GetStack(client, pageID)
+	if err != nil {
+		return err
+	}
+	blocks, err := GetChildren(client, stack.GetID())
+	if err != nil {
+		return err
+	}
+	rich, plain, _, err := ParseStackFromBlocks(client, blocks, pageID)
+	if err != nil {
+		return err
+	}
+	order := []int{}
+	for i := range blocks {
+		order = append(order, i)
+	}
+	if sel.IsEmpty() {
+		if err := requireInteractive("entry selector"); err != nil {
+			return err
+		}
+		if order, err = askOrder(*rich, order); err != nil {
+			return err
+		}
+	} else {
+		if err := to.validate(); err != nil {
+			return err
+		}
+		selected, err := SelectEntries(blocks, *plain, sel)
+		if err != nil {
+			return err
+		}
+		after := -1
+		if to.After != "" {
+			if anchor, err := SelectEntries(blocks, *plain, Selector{Keys: []string{to.After}}); err != nil {
+				return err
+			} else if after = anchor[0]; utils.IsIn(after, selected) {
+				return errors.New("cannot move entries after one of themselves")
+			}
+		}
+		order = placed(order, selected, to, after)
+	}
+	if unchanged(order) {
+		return nil
+	}
+	return reorder(client, stack.GetID(), blocks, order)
+}
+
+// askOrder lets the user move entries around one at a time until done.
+func askOrder(labels []string, order []int) ([]int, error) {
+	const done = "✓ done"
+	for {
+		options := []string{}
+		for _, idx := range order {
+			options = append(options, labels[idx])
+		}
+		pick := -1
+		if err := survey.AskOne(
+			&survey.Select{
+				Message: "move:",
+				Options: append(options, done),
+			},
+			&pick,
+			survey.WithPageSize(10),
+		); err != nil {
+			return nil, err
+		}
+		if pick == len(order) {
+			return order, nil
+		}
+		targets := []string{"to the top", "to the bottom"}
+		anchors := []int{}
+		for _, idx := range order {
+			if idx != order[pick] {
+				targets = append(targets, "after "+labels[idx])
+				anchors = append(anchors, idx)
+			}
+		}
+		where := -1
+		if err := survey.AskOne(
+			&survey.Select{
+				Message: "where to:",
+				Options: targets,
+			},
+			&where,
+			survey.WithPageSize(10),
+		); err != nil {
+			return nil, err
+		}
+		switch where {
+		case 0:
+			order = placed(order, []int{order[pick]}, Placement{Top: true}, -1)
+		case 1:
+			order = placed(order, []int{order[pick]}, Placement{Bottom: true}, -1)
+		default:
+			order = placed(order, []int{order[pick]}, Placement{}, anchors[where-2])
+		}
+	}
+}
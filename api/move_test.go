@@ -0,0 +1,36 @@
+package api
+
+import (
+	"testing"
+
+	notion "github.com/jomei/notionapi"
+)
+
+func TestMoveStack(t *testing.T) {
+	runStackTests(t, []stackTest{
+		{
+			name: "move to the top",
+			entries: []notion.Block{
+				todo("a", false),
+				todo("b", true),
+				todo("c", false, todo("c1", false)),
+			},
+			run: func(client NotionAPI, pageID string) error {
+				return MoveStack(client, pageID, Selector{Keys: []string{"3"}}, Placement{Top: true})
+			},
+			want: []string{"[ ] c", "  [ ] c1", "[ ] a", "[x] b"},
+		},
+		{
+			name: "move after",
+			entries: []notion.Block{
+				todo("a", false),
+				todo("b", true),
+				todo("c", false),
+			},
+			run: func(client NotionAPI, pageID string) error {
+				return MoveStack(client, pageID, Selector{Keys: []string{"1"}}, Placement{After: "2"})
+			},
+			want: []string{"[x] b", "[ ] a", "[ ] c"},
+		},
+	})
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	notion "github.com/jomei/notionapi"
+	"gopkg.in/yaml.v3"
+)
+
+type OutputFormat string
+
+const (
+	OutputText OutputFormat = "text"
+	OutputJSON OutputFormat = "json"
+	OutputYAML OutputFormat = "yaml"
+	OutputTSV  OutputFormat = "tsv"
+)
+
+func ParseOutputFormat(format string) (OutputFormat, error) {
+	switch OutputFormat(strings.ToLower(format)) {
+	case "", OutputText:
+		return OutputText, nil
+	case OutputJSON:
+		return OutputJSON, nil
+	case OutputYAML, "yml":
+		return OutputYAML, nil
+	case OutputTSV:
+		return OutputTSV, nil
+	default:
+		return "", fmt.Errorf("unknown output format `%s` (text, json, yaml, tsv)", format)
+	}
+}
+
+func encodeStructured(w io.Writer, format OutputFormat, v interface{}) error {
+	switch format {
+	case OutputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case OutputYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("cannot encode as `%s`", format)
+	}
+}
+
+func tsvField(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r").Replace(s)
+}
+
+func tsvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func EncodeStack(w io.Writer, format OutputFormat, entries []StackEntry) error {
+	if format != OutputTSV {
+		return encodeStructured(w, format, entries)
+	}
+	if _, err := fmt.Fprintln(w, "index\tid\tchecked\ttext\tcreated_time\tlast_edited_time\tdue\tpriority\ttags"); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Index, e.ID, strconv.FormatBool(e.Checked), tsvField(e.Text), tsvTime(e.CreatedTime), tsvTime(e.LastEditedTime),
+			tsvTime(e.Due), e.Priority, tsvField(strings.Join(e.Tags, ",")),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeBlocksTSV(w io.Writer, blocks []BlockEntry, depth int) error {
+	for _, b := range blocks {
+		checked := ""
+		if b.Checked != nil {
+			checked = strconv.FormatBool(*b.Checked)
+		}
+		if _, err := fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", depth, b.ID, b.Type, checked, tsvField(b.Text)); err != nil {
+			return err
+		}
+		if err := encodeBlocksTSV(w, b.Children, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func EncodePage(w io.Writer, format OutputFormat, view PageView) error {
+	if format != OutputTSV {
+		return encodeStructured(w, format, view)
+	}
+	if _, err := fmt.Fprintln(w, "depth\tid\ttype\tchecked\ttext"); err != nil {
+		return err
+	}
+	return encodeBlocksTSV(w, view.Blocks, 0)
+}
+
+func NewPageView(client NotionAPI, pageID string) (PageView, error) {
+	if page, err := client.GetPage(context.Background(), notion.PageID(pageID)); err != nil {
+		return PageView{}, fmt.Errorf("failed to get page: %w", err)
+	} else {
+		if blocks, err := NewBlockEntries(client, notion.BlockID(pageID)); err != nil {
+			return PageView{}, fmt.Errorf("failed to get block children: %w", err)
+		} else {
+			return PageView{
+				ID:     string(page.ID),
+				Title:  PageTitle(page),
+				URL:    page.URL,
+				Blocks: blocks,
+			}, nil
+		}
+	}
+}
+
+// ShowStack renders the stack page; a non-empty query lists only the matching
+// entries (with their sub-tasks) in its order.
+func ShowStack(client NotionAPI, pageID string, format OutputFormat, query StackQuery) error {
+	if err := query.Validate(); err != nil {
+		return err
+	}
+	if format == OutputText && query.IsEmpty() && query.Sort == "" && query.Limit == 0 {
+		return ShowPage(client, pageID, -1)
+	}
+	if format == OutputText {
+		return showStackEntries(client, pageID, query)
+	}
+	if blocks, err := GetStackEntries(client, pageID); err != nil {
+		return err
+	} else if entries, err := NewStackEntryTree(client, blocks); err != nil {
+		return err
+	} else {
+		selected := []StackEntry{}
+		for _, i := range query.Apply(entries, Now()) {
+			selected = append(selected, entries[i])
+		}
+		return EncodeStack(os.Stdout, format, selected)
+	}
+}
+
+func showStackEntries(client NotionAPI, pageID string, query StackQuery) error {
+	client, err := Prefetch(client, notion.BlockID(pageID), -1, Concurrency)
+	if err != nil {
+		return fmt.Errorf("failed to get block children: %w", err)
+	}
+	rc := NewRenderContext(client)
+	if page, err := client.GetPage(context.Background(), notion.PageID(pageID)); err != nil {
+		return fmt.Errorf("failed to get page: %w", err)
+	} else if err := ShowPageTitle(rc, page); err != nil {
+		return fmt.Errorf("failed to show page title: %w", err)
+	}
+	if blocks, err := GetStackEntries(client, pageID); err != nil {
+		return err
+	} else {
+		for _, i := range query.Apply(NewStackEntries(blocks), Now()) {
+			if err := ShowBlock(rc.Indented(2), blocks[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// ShowPageAs renders a page in the given format; depth only applies to the
+// text format (see Block2String), negative meaning no limit.
+func ShowPageAs(client NotionAPI, pageID string, format OutputFormat, depth int) error {
+	if format == OutputText {
+		return ShowPage(client, pageID, depth)
+	}
+	if view, err := NewPageView(client, pageID); err != nil {
+		return err
+	} else {
+		return EncodePage(os.Stdout, format, view)
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestEncodeStack(t *testing.T) {
+	created := time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC)
+	edited := time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)
+	due := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	entries := []StackEntry{
+		{
+			Index:          1,
+			ID:             "a1",
+			Text:           "pay rent\t!high #home",
+			RichText:       []Span{{Type: "text", Text: "pay rent\t"}, {Type: "text", Text: "!high", Bold: true, Color: "red"}},
+			Checked:        false,
+			CreatedTime:    &created,
+			LastEditedTime: &edited,
+			Due:            &due,
+			Priority:       "high",
+			Tags:           []string{"home", "bills"},
+			Subtasks: []StackEntry{
+				{Index: 1, ID: "b1", Text: "transfer", RichText: []Span{{Type: "text", Text: "transfer"}}, Checked: true},
+			},
+		},
+		{Index: 2, ID: "a2", Text: "call bob", RichText: []Span{}},
+	}
+	tests := []struct {
+		format OutputFormat
+		want   string
+	}{
+		{OutputJSON, `[
+  {
+    "index": 1,
+    "id": "a1",
+    "text": "pay rent\t!high #home",
+    "rich_text": [
+      {
+        "type": "text",
+        "text": "pay rent\t"
+      },
+      {
+        "type": "text",
+        "text": "!high",
+        "bold": true,
+        "color": "red"
+      }
+    ],
+    "checked": false,
+    "created_time": "2026-10-15T09:30:00Z",
+    "last_edited_time": "2026-10-16T18:00:00Z",
+    "due": "2026-11-01T00:00:00Z",
+    "priority": "high",
+    "tags": [
+      "home",
+      "bills"
+    ],
+    "subtasks": [
+      {
+        "index": 1,
+        "id": "b1",
+        "text": "transfer",
+        "rich_text": [
+          {
+            "type": "text",
+            "text": "transfer"
+          }
+        ],
+        "checked": true
+      }
+    ]
+  },
+  {
+    "index": 2,
+    "id": "a2",
+    "text": "call bob",
+    "rich_text": [],
+    "checked": false
+  }
+]
+`},
+		{OutputYAML, `- index: 1
+  id: a1
+  text: "pay rent\t!high #home"
+  rich_text:
+    - type: text
+      text: "pay rent\t"
+    - type: text
+      text: '!high'
+      bold: true
+      color: red
+  checked: false
+  created_time: 2026-10-15T09:30:00Z
+  last_edited_time: 2026-10-16T18:00:00Z
+  due: 2026-11-01T00:00:00Z
+  priority: high
+  tags:
+    - home
+    - bills
+  subtasks:
+    - index: 1
+      id: b1
+      text: transfer
+      rich_text:
+        - type: text
+          text: transfer
+      checked: true
+- index: 2
+  id: a2
+  text: call bob
+  rich_text: []
+  checked: false
+`},
+		{OutputTSV, "index\tid\tchecked\ttext\tcreated_time\tlast_edited_time\tdue\tpriority\ttags\n" +
+			// tabs inside the text are escaped, sub-tasks are left out
+			"1\ta1\tfalse\tpay rent\\t!high #home\t2026-10-15T09:30:00Z\t2026-10-16T18:00:00Z\t2026-11-01T00:00:00Z\thigh\thome,bills\n" +
+			"2\ta2\tfalse\tcall bob\t\t\t\t\t\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := EncodeStack(&buf, tt.format, entries); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for in, want := range map[string]OutputFormat{
+		"":     OutputText,
+		"text": OutputText,
+		"JSON": OutputJSON,
+		"yaml": OutputYAML,
+		"yml":  OutputYAML,
+		"tsv":  OutputTSV,
+	} {
+		if got, err := ParseOutputFormat(in); err != nil || got != want {
+			t.Errorf("ParseOutputFormat(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseOutputFormat("csv"); err == nil {
+		t.Error("ParseOutputFormat(\"csv\") did not fail")
+	}
+}
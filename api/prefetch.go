@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"sync"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// Concurrency is the number of parallel requests used to prefetch block
+// trees. Notion allows about three requests per second on average, so going
+// much higher mostly trades waiting for rate-limit errors.
+var Concurrency = 3
+
+// memoClient remembers fetched children, so that the discovery and the
+// rendering passes of a tree export hit the API only once per block.
+type memoClient struct {
+	NotionAPI
+	mu       sync.Mutex
+	children map[string]*notion.GetChildrenResponse
+}
+
+func newMemoClient(client NotionAPI) *memoClient {
+	return &memoClient{NotionAPI: client, children: map[string]*notion.GetChildrenResponse{}}
+}
+
+func (c *memoClient) GetBlockChildren(ctx context.Context, id notion.BlockID, pagination *notion.Pagination) (*notion.GetChildrenResponse, error) {
+	key := string(id)
+	if pagination != nil {
+		key += "/" + string(pagination.StartCursor)
+	}
+	c.mu.Lock()
+	cached, ok := c.children[key]
+	c.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+	if response, err := c.NotionAPI.GetBlockChildren(ctx, id, pagination); err != nil {
+		return nil, err
+	} else {
+		c.mu.Lock()
+		c.children[key] = response
+		c.mu.Unlock()
+		return response, nil
+	}
+}
+
+// prefetchChildren reports whether the children of a block are fetched ahead
+// of rendering, and the depth left for them (see RenderContext.Depth).
+func prefetchChildren(b notion.Block, depth int) (bool, int) {
+	switch {
+	case !b.GetHasChildren() || b.GetType() == notion.BlockTypeChildDatabase:
+		return false, depth
+	case b.GetType() == notion.BlockTypeChildPage && depth < 0:
+		return false, depth
+	case b.GetType() == notion.BlockTypeColumn || b.GetType() == notion.BlockTypeSyncedBlock ||
+		b.GetType() == notion.BlockTypeTableBlock || depth < 0:
+		return true, depth
+	default:
+		return depth > 0, depth - 1
+	}
+}
+
+// Prefetch walks the block tree under rootID with at most `concurrency`
+// requests in flight and returns a client that serves the fetched children
+// from memory; rendering from it keeps the output order deterministic.
+func Prefetch(client NotionAPI, rootID notion.BlockID, depth, concurrency int) (NotionAPI, error) {
+	memo := newMemoClient(client)
+	slots := make(chan struct{}, max(concurrency, 1))
+	failed := make(chan struct{})
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		fetchErr error
+	)
+	var fetch func(id notion.BlockID, depth int)
+	fetch = func(id notion.BlockID, depth int) {
+		defer wg.Done()
+		select {
+		case <-failed:
+			return
+		case slots <- struct{}{}:
+		}
+		children, err := GetChildren(memo, id)
+		<-slots
+		if err != nil {
+			once.Do(func() {
+				fetchErr = err
+				close(failed)
+			})
+			return
+		}
+		for _, child := range children {
+			if descend, depth := prefetchChildren(child, depth); descend {
+				wg.Add(1)
+				go fetch(child.GetID(), depth)
+			}
+		}
+	}
+	wg.Add(1)
+	go fetch(rootID, depth)
+	wg.Wait()
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	return memo, nil
+}
@@ -3,34 +3,61 @@ package api
 import (
 	"context"
 	"fmt"
+	"sort"
 
+	"github.com/haykh/nogo/config"
 	"github.com/haykh/nogo/utils"
 
 	notion "github.com/jomei/notionapi"
 )
 
-func ShowPage(client *notion.Client, pageID string) error {
-	if page, err := client.Page.Get(context.Background(), notion.PageID(pageID)); err != nil {
+func ShowPage(client NotionAPI, pageID string, depth int) error {
+	client, err := Prefetch(client, notion.BlockID(pageID), depth, Concurrency)
+	if err != nil {
+		return fmt.Errorf("failed to get block children: %w", err)
+	}
+	rc := NewRenderContext(client)
+	rc.Depth = depth
+	if page, err := client.GetPage(context.Background(), notion.PageID(pageID)); err != nil {
 		return fmt.Errorf("failed to get page: %w", err)
 	} else {
-		if err := ShowPageTitle(page); err != nil {
+		if err := ShowPageTitle(rc, page); err != nil {
 			return fmt.Errorf("failed to show page title: %w", err)
 		}
-		if blocks, err := client.Block.GetChildren(context.Background(), notion.BlockID(pageID), nil); err != nil {
+		if blocks, err := GetChildren(client, notion.BlockID(pageID)); err != nil {
 			return fmt.Errorf("failed to get block children: %w", err)
+		} else if str, err := Blocks2String(rc, blocks); err != nil {
+			return fmt.Errorf("failed to show the blocks: %w", err)
 		} else {
-			for _, block := range blocks.Results {
-				if err := ShowBlock(client, block, 0); err != nil {
-					return fmt.Errorf("failed to show the block: %w", err)
-				}
-			}
+			fmt.Print(str)
 			return nil
 		}
 	}
 }
 
-func ShowBlock(c *notion.Client, b notion.Block, level int) error {
-	if str, err := Block2String(c, b, level); err != nil {
+func ShowStacks(loc_config config.LocalParseTemplate) error {
+	stacks := loc_config.GetStacks()
+	if len(stacks) == 0 {
+		return fmt.Errorf("no stacks registered, add one with `nogo stack register`")
+	}
+	names := []string{}
+	for name := range stacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	def := loc_config.GetDefaultStack()
+	for _, name := range names {
+		if name == def {
+			fmt.Printf("%s* %s%s  %s\n", utils.ColorGreen, name, utils.ColorReset, stacks[name])
+		} else {
+			fmt.Printf("  %s  %s\n", name, stacks[name])
+		}
+	}
+	return nil
+}
+
+func ShowBlock(rc RenderContext, b notion.Block) error {
+	if str, err := Block2String(rc, b); err != nil {
 		return err
 	} else {
 		fmt.Print(str)
@@ -38,53 +65,53 @@ func ShowBlock(c *notion.Client, b notion.Block, level int) error {
 	}
 }
 
-func ShowTitle(title *notion.TitleProperty) error {
-	fmt.Print(Title2String(title))
+func ShowTitle(rc RenderContext, title *notion.TitleProperty) error {
+	fmt.Print(Title2String(rc, title))
 	return nil
 }
 
-func ShowPageTitle(page *notion.Page) error {
-	fmt.Print(PageTitle2String(page))
+func ShowPageTitle(rc RenderContext, page *notion.Page) error {
+	fmt.Print(PageTitle2String(rc, page))
 	return nil
 }
 
-func ShowRichText(rts []notion.RichText, prefix string, level int, style ...utils.TextStyle) error {
-	fmt.Print(RichText2String(rts, prefix, level, style...))
+func ShowRichText(rc RenderContext, rts []notion.RichText, prefix string, style ...utils.TextStyle) error {
+	fmt.Print(RichText2String(rc, rts, prefix, style...))
 	return nil
 }
 
-func ShowParagraph(b notion.Block, level int) error {
-	fmt.Print(Paragraph2String(b, level))
+func ShowParagraph(rc RenderContext, b notion.Block) error {
+	fmt.Print(Paragraph2String(rc, b))
 	return nil
 }
 
-func ShowHeading(b interface{}, level int) error {
+func ShowHeading(rc RenderContext, b interface{}) error {
 	switch b.(type) {
 	case *notion.Heading1Block, *notion.Heading2Block, *notion.Heading3Block:
-		fmt.Print(Heading2String(b, level))
+		fmt.Print(Heading2String(rc, b))
 		return nil
 	default:
 		return fmt.Errorf("unknown heading type")
 	}
 }
 
-func ShowToDo(b notion.Block, level int) error {
-	fmt.Print(ToDo2String(b, level))
+func ShowToDo(rc RenderContext, b notion.Block) error {
+	fmt.Print(ToDo2String(rc, b))
 	return nil
 }
 
-func ShowBulletedListItem(b notion.Block, level int) error {
-	fmt.Print(BulletedListItem2String(b, level))
+func ShowBulletedListItem(rc RenderContext, b notion.Block) error {
+	fmt.Print(BulletedListItem2String(rc, b))
 	return nil
 }
 
-func ShowNumberedListItem(b notion.Block, level int) error {
-	fmt.Print(NumberedListItem2String(b, level))
+func ShowNumberedListItem(rc RenderContext, b notion.Block) error {
+	fmt.Print(NumberedListItem2String(rc, b))
 	return nil
 }
 
-func ShowToggle(c *notion.Client, b notion.Block, open bool, level int) error {
-	if str, err := Toggle2String(c, b, open, level); err != nil {
+func ShowToggle(rc RenderContext, b notion.Block) error {
+	if str, err := Toggle2String(rc, b); err != nil {
 		return err
 	} else {
 		fmt.Print(str)
@@ -92,23 +119,23 @@ func ShowToggle(c *notion.Client, b notion.Block, open bool, level int) error {
 	}
 }
 
-func ShowEquation(b notion.Block, level int) error {
-	fmt.Print(Equation2String(b, level))
+func ShowEquation(rc RenderContext, b notion.Block) error {
+	fmt.Print(Equation2String(rc, b))
 	return nil
 }
 
-func ShowCode(b notion.Block, level int) error {
-	fmt.Print(Code2String(b, level))
+func ShowCode(rc RenderContext, b notion.Block) error {
+	fmt.Print(Code2String(rc, b))
 	return nil
 }
 
-func ShowDivider(b notion.Block, level int) error {
-	fmt.Print(Divider2String(b, level))
+func ShowDivider(rc RenderContext, b notion.Block) error {
+	fmt.Print(Divider2String(rc, b))
 	return nil
 }
 
-func ShowColumn(c *notion.Client, b notion.Block, level int) error {
-	if str, err := Column2String(c, b, level); err != nil {
+func ShowColumn(rc RenderContext, b notion.Block) error {
+	if str, err := Column2String(rc, b); err != nil {
 		return err
 	} else {
 		fmt.Print(str)
@@ -116,8 +143,8 @@ func ShowColumn(c *notion.Client, b notion.Block, level int) error {
 	}
 }
 
-func ShowColumnList(c *notion.Client, b notion.Block, level int) error {
-	if str, err := ColumnList2String(c, b, level); err != nil {
+func ShowColumnList(rc RenderContext, b notion.Block) error {
+	if str, err := ColumnList2String(rc, b); err != nil {
 		return err
 	} else {
 		fmt.Print(str)
@@ -125,12 +152,16 @@ func ShowColumnList(c *notion.Client, b notion.Block, level int) error {
 	}
 }
 
-func ShowImage(b notion.Block, level int) error {
-	fmt.Print(Image2String(b, level))
+func ShowImage(rc RenderContext, b notion.Block) error {
+	fmt.Print(Image2String(rc, b))
 	return nil
 }
 
-func ShowChildPage(b notion.Block, level int) error {
-	fmt.Print(ChildPage2String(b, level))
-	return nil
+func ShowChildPage(rc RenderContext, b notion.Block) error {
+	if str, err := ChildPage2String(rc, b); err != nil {
+		return err
+	} else {
+		fmt.Print(str)
+		return nil
+	}
 }
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// scripted answers the n-th request with the n-th status (the last one once
+// they run out) and records the bodies it received.
+type scripted struct {
+	mu       sync.Mutex
+	statuses []int
+	header   http.Header
+	bodies   []string
+}
+
+func (s *scripted) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	s.bodies = append(s.bodies, string(body))
+	status := s.statuses[min(len(s.bodies), len(s.statuses))-1]
+	for k, v := range s.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(status)
+}
+
+func testTransport() *retryTransport {
+	return &retryTransport{
+		base:       http.DefaultTransport,
+		limiter:    newTokenBucket(1000, 1000),
+		maxRetries: 3,
+		baseDelay:  time.Millisecond,
+		maxDelay:   5 * time.Millisecond,
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int
+		requests int
+	}{
+		{"success", []int{200}, 200, 1},
+		{"rate limited", []int{429, 200}, 200, 2},
+		{"transient errors", []int{502, 503, 504, 200}, 200, 4},
+		{"gives up after the retries", []int{429}, 429, 4},
+		{"client errors are not retried", []int{400, 200}, 400, 1},
+		{"internal errors are not retried", []int{500, 200}, 500, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &scripted{statuses: tt.statuses}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+			client := &http.Client{Transport: testTransport()}
+			res, err := client.Post(ts.URL, "application/json", strings.NewReader(`{"archived":true}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != tt.want {
+				t.Errorf("got status %d, want %d", res.StatusCode, tt.want)
+			}
+			if len(server.bodies) != tt.requests {
+				t.Errorf("sent %d requests, want %d", len(server.bodies), tt.requests)
+			}
+			for i, body := range server.bodies {
+				if body != `{"archived":true}` {
+					t.Errorf("request %d had body %q", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	server := &scripted{statuses: []int{429, 200}, header: http.Header{"Retry-After": {"1"}}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	client := &http.Client{Transport: testTransport()}
+	start := time.Now()
+	res, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, want at least the 1s of Retry-After", elapsed)
+	}
+	if res.StatusCode != 200 || len(server.bodies) != 2 {
+		t.Errorf("got status %d after %d requests, want 200 after 2", res.StatusCode, len(server.bodies))
+	}
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	for header, want := range map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"Sun, 18 Oct 2026 12:00:10 GMT": 10 * time.Second,
+		"soon":                          0,
+	} {
+		if got := retryAfter(header, now); got != want {
+			t.Errorf("retryAfter(%q) = %s, want %s", header, got, want)
+		}
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	server := &scripted{statuses: []int{503}, header: http.Header{"Retry-After": {"60"}}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	if _, err := (&http.Client{Transport: testTransport()}).Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the deadline to cut the Retry-After wait short", err)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	b := newTokenBucket(3, 3)
+	b.now = func() time.Time { return now }
+	steps := []struct {
+		advance time.Duration
+		want    time.Duration
+	}{
+		// a full bucket allows a burst
+		{0, 0},
+		{0, 0},
+		{0, 0},
+		// then one token every third of a second
+		{0, time.Second / 3},
+		{0, 2 * time.Second / 3},
+		// waiting pays the debt back and refills it, but never above the burst
+		{time.Second, 0},
+		{10 * time.Second, 0},
+		{0, 0},
+		{0, 0},
+		{0, time.Second / 3},
+	}
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		if got := b.reserve(); (got - step.want).Abs() > time.Millisecond {
+			t.Errorf("reservation %d: wait %s, want %s", i+1, got, step.want)
+		}
+	}
+}
+
+// redirect sends every request to the test server instead of notion.
+type redirect struct {
+	target *url.URL
+}
+
+func (r redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = r.target.Scheme, r.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestTimeout(t *testing.T) {
+	var delay atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(delay.Load()))
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"object":"block","id":"b","type":"paragraph","paragraph":{"rich_text":[]}}`)
+	}))
+	defer ts.Close()
+	target, _ := url.Parse(ts.URL)
+	defer func(timeout time.Duration) { Timeout = timeout }(Timeout)
+	Timeout = 100 * time.Millisecond
+	client := newClient("secret", redirect{target})
+
+	// the timeout counts from each request, not from when the client was made
+	time.Sleep(2 * Timeout)
+	if _, err := client.GetBlock(context.Background(), "b"); err != nil {
+		t.Fatalf("request after a pause failed: %v", err)
+	}
+
+	delay.Store(int64(3 * Timeout))
+	_, err := client.GetBlock(context.Background(), "b")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a deadline error", err)
+	}
+	if unreachable(err) {
+		t.Error("a timed out request counts as unreachable and would be queued offline")
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection refused", &url.Error{Op: "Get", URL: notionURL, Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{"timeout", &url.Error{Op: "Get", URL: notionURL, Err: context.DeadlineExceeded}, false},
+		{"rejected by notion", &notion.Error{Status: 400, Message: "invalid"}, false},
+	}
+	for _, tt := range tests {
+		if got := unreachable(tt.err); got != tt.want {
+			t.Errorf("%s: unreachable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
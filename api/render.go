@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/haykh/nogo/utils"
+)
+
+// RenderContext carries the state of a terminal render down the block tree.
+// It is passed by value: nested blocks get a modified copy, so renders of
+// different pages (or subtrees) never share state and can run in parallel.
+type RenderContext struct {
+	Client NotionAPI
+	// Level is the indentation (in spaces) of the block being rendered.
+	Level int
+	// Depth is the number of nested levels (toggles, columns, children, child
+	// pages) still to expand; negative expands everything but child pages.
+	Depth int
+	// Width of the terminal, 0 if unknown.
+	Width int
+	// Color enables ANSI colours and hyperlinks.
+	Color bool
+	// ListNesting counts the numbered lists enclosing the block; it picks the
+	// numbering style (1., a., i.).
+	ListNesting int
+	// number is the position of a numbered list item among its siblings.
+	number int
+}
+
+func NewRenderContext(client NotionAPI) RenderContext {
+	return RenderContext{
+		Client: client,
+		Depth:  -1,
+		Width:  utils.TerminalWidth(),
+		Color:  true,
+	}
+}
+
+func (rc RenderContext) Indented(n int) RenderContext {
+	rc.Level += n
+	return rc
+}
+
+// expand reports whether a container block gets its children rendered, and
+// the context to render them with.
+func (rc RenderContext) expand() (bool, RenderContext) {
+	if rc.Depth < 0 {
+		return true, rc
+	}
+	rc.Depth--
+	return rc.Depth >= 0, rc
+}
+
+func (rc RenderContext) finish(s string) string {
+	if rc.Color {
+		return s
+	}
+	return escapePattern.ReplaceAllString(s, "")
+}
+
+var romanNumerals = []struct {
+	value  int
+	symbol string
+}{
+	{1000, "m"}, {900, "cm"}, {500, "d"}, {400, "cd"}, {100, "c"}, {90, "xc"},
+	{50, "l"}, {40, "xl"}, {10, "x"}, {9, "ix"}, {5, "v"}, {4, "iv"}, {1, "i"},
+}
+
+func roman(n int) string {
+	result := ""
+	for _, r := range romanNumerals {
+		for n >= r.value {
+			result += r.symbol
+			n -= r.value
+		}
+	}
+	return result
+}
+
+func alphabetic(n int) string {
+	result := ""
+	for ; n > 0; n = (n - 1) / 26 {
+		result = string(rune('a'+(n-1)%26)) + result
+	}
+	return result
+}
+
+// ListMarker numbers a list item the way notion does: 1., a., i., 1., ...
+// with growing nesting.
+func ListMarker(number, nesting int) string {
+	switch nesting % 3 {
+	case 1:
+		return alphabetic(number) + "."
+	case 2:
+		return roman(number) + "."
+	default:
+		return fmt.Sprintf("%d.", number)
+	}
+}
+
+func (rc RenderContext) rule() string {
+	if rc.Width > rc.Level {
+		return strings.Repeat("─", rc.Width-rc.Level)
+	}
+	return "---"
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/haykh/nogo/config"
+	"github.com/haykh/nogo/utils"
+
+	survey "github.com/AlecAivazis/survey/v2"
+	notion "github.com/jomei/notionapi"
+)
+
+// SearchQuery is what `nogo search` asks notion for.
+type SearchQuery struct {
+	Text string
+	// Type is "page", "database" or empty for both.
+	Type string
+	// PageSize is the number of results fetched (and offered) at once.
+	PageSize int
+	// All fetches every page of results instead of the first.
+	All bool
+}
+
+func (q SearchQuery) Validate() error {
+	switch q.Type {
+	case "", "page", "database":
+	default:
+		return fmt.Errorf("unknown type `%s` (page, database)", q.Type)
+	}
+	if q.PageSize < 1 || q.PageSize > 100 {
+		return errors.New("--limit must be between 1 and 100")
+	}
+	return nil
+}
+
+type SearchResult struct {
+	ID             string    `json:"id" yaml:"id"`
+	Type           string    `json:"type" yaml:"type"`
+	Title          string    `json:"title" yaml:"title"`
+	Icon           string    `json:"icon,omitempty" yaml:"icon,omitempty"`
+	URL            string    `json:"url" yaml:"url"`
+	LastEditedTime time.Time `json:"last_edited_time" yaml:"last_edited_time"`
+	// page is the result as a page, databases included, for rendering.
+	page *notion.Page
+}
+
+func NewSearchResult(o notion.Object) (SearchResult, bool) {
+	switch o := o.(type) {
+	case *notion.Page:
+		return SearchResult{
+			ID:             string(o.ID),
+			Type:           "page",
+			Title:          PageTitle(o),
+			Icon:           emoji(o.Icon),
+			URL:            o.URL,
+			LastEditedTime: o.LastEditedTime,
+			page:           o,
+		}, true
+	case *notion.Database:
+		return SearchResult{
+			ID:             string(o.ID),
+			Type:           "database",
+			Title:          RichText2Plain(o.Title),
+			Icon:           emoji(o.Icon),
+			URL:            o.URL,
+			LastEditedTime: o.LastEditedTime,
+			page: &notion.Page{
+				Icon:       o.Icon,
+				Properties: notion.Properties{"title": &notion.TitleProperty{Title: o.Title}},
+			},
+		}, true
+	default:
+		return SearchResult{}, false
+	}
+}
+
+func emoji(icon *notion.Icon) string {
+	if icon != nil && icon.Type == "emoji" && icon.Emoji != nil {
+		return string(*icon.Emoji)
+	}
+	return ""
+}
+
+// String renders the result on one line: its icon and title, then its type
+// and when it was last edited.
+func (r SearchResult) String(rc RenderContext) string {
+	title := strings.TrimRight(PageTitle2String(rc, r.page), "\n")
+	return fmt.Sprintf("%s  %s%s · edited %s%s", title, utils.HiDim, r.Type, r.LastEditedTime.Local().Format("Jan 2 2006"), utils.HiReset)
+}
+
+// searcher pages through the results of a search, most recently edited first.
+type searcher struct {
+	client  NotionAPI
+	request *notion.SearchRequest
+	done    bool
+}
+
+func newSearcher(client NotionAPI, q SearchQuery) *searcher {
+	request := &notion.SearchRequest{
+		Query:    q.Text,
+		Sort:     &notion.SortObject{Timestamp: notion.TimestampLastEdited, Direction: notion.SortOrderDESC},
+		PageSize: q.PageSize,
+	}
+	if q.Type != "" {
+		request.Filter = notion.SearchFilter{Property: "object", Value: q.Type}
+	}
+	return &searcher{client: client, request: request}
+}
+
+func (s *searcher) next() ([]SearchResult, error) {
+	response, err := s.client.Search(context.Background(), s.request)
+	if err != nil {
+		return nil, err
+	}
+	results := []SearchResult{}
+	for _, o := range response.Results {
+		if r, ok := NewSearchResult(o); ok {
+			results = append(results, r)
+		}
+	}
+	s.request.StartCursor = response.NextCursor
+	s.done = !response.HasMore || response.NextCursor == ""
+	return results, nil
+}
+
+func EncodeSearch(w io.Writer, format OutputFormat, results []SearchResult) error {
+	if format != OutputTSV {
+		return encodeStructured(w, format, results)
+	}
+	if _, err := fmt.Fprintln(w, "id\ttype\ttitle\tlast_edited_time\turl"); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.ID, r.Type, tsvField(r.Title), tsvTime(&r.LastEditedTime), r.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ShowSearch lists the pages and databases matching the query; with pick it
+// lets the user choose one to open or save as an alias instead.
+func ShowSearch(client NotionAPI, loc_config config.LocalParseTemplate, q SearchQuery, format OutputFormat, pick bool) error {
+	if err := q.Validate(); err != nil {
+		return err
+	} else if Offline {
+		return fmt.Errorf("search: %w", ErrNotCached)
+	}
+	s := newSearcher(client, q)
+	if pick {
+		if err := requireInteractive("page"); err != nil {
+			return err
+		}
+		return pickSearchResult(client, loc_config, s)
+	}
+	results := []SearchResult{}
+	for !s.done && (q.All || len(results) == 0) {
+		if page, err := s.next(); err != nil {
+			return err
+		} else if results = append(results, page...); !q.All {
+			break
+		}
+	}
+	if format != OutputText {
+		return EncodeSearch(os.Stdout, format, results)
+	}
+	if len(results) == 0 {
+		fmt.Println("nothing found")
+		return nil
+	}
+	rc := NewRenderContext(client)
+	for _, r := range results {
+		fmt.Println(r.String(rc))
+	}
+	if !s.done {
+		fmt.Printf("%s… more results, narrow the query or use --all%s\n", utils.HiDim, utils.HiReset)
+	}
+	return nil
+}
+
+// pickSearchResult offers the results a page at a time until one is picked.
+func pickSearchResult(client NotionAPI, loc_config config.LocalParseTemplate, s *searcher) error {
+	const more = "… more results"
+	rc := NewRenderContext(client)
+	results := []SearchResult{}
+	options := []string{}
+	for {
+		page, err := s.next()
+		if err != nil {
+			return err
+		}
+		for _, r := range page {
+			results = append(results, r)
+			options = append(options, utils.Clean(r.String(rc)))
+		}
+		if len(results) == 0 {
+			fmt.Println("nothing found")
+			return nil
+		}
+		offered := options
+		if !s.done {
+			offered = append(offered[:len(offered):len(offered)], more)
+		}
+		idx := -1
+		if err := survey.AskOne(
+			&survey.Select{
+				Message: "open:",
+				Options: offered,
+			},
+			&idx,
+			survey.WithPageSize(10),
+		); err != nil {
+			return err
+		}
+		if idx < len(results) {
+			return actOnSearchResult(client, loc_config, results[idx])
+		}
+	}
+}
+
+// aliasFor suggests an alias for a title: its words, lowercased and joined by
+// dashes.
+func aliasFor(title string) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !(r == '_' || r == '-' || ('a' <= r && r <= 'z') || ('0' <= r && r <= '9'))
+	})
+	return strings.Join(words, "-")
+}
+
+func actOnSearchResult(client NotionAPI, loc_config config.LocalParseTemplate, r SearchResult) error {
+	const (
+		open  = "open"
+		alias = "save as alias"
+		url   = "print url"
+	)
+	actions := []string{url}
+	if r.Type == "page" {
+		actions = []string{open, alias, url}
+	}
+	action := ""
+	if err := survey.AskOne(
+		&survey.Select{
+			Message: r.Title + ":",
+			Options: actions,
+		},
+		&action,
+	); err != nil {
+		return err
+	}
+	switch action {
+	case open:
+		if cached, err := NewCacheClient(client, r.ID); err != nil {
+			return err
+		} else {
+			return ShowPage(cached, r.ID, -1)
+		}
+	case alias:
+		name := ""
+		if err := survey.AskOne(&survey.Input{
+			Message: "alias:",
+			Default: aliasFor(r.Title),
+		}, &name, survey.WithValidator(survey.Required)); err != nil {
+			return err
+		}
+		return SaveAlias(client, loc_config, name, r.ID)
+	default:
+		fmt.Println(r.URL)
+		return nil
+	}
+}
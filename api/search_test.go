@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haykh/nogo/config"
+	notion "github.com/jomei/notionapi"
+)
+
+// searchCounter counts the pages of search results fetched.
+type searchCounter struct {
+	NotionAPI
+	calls int
+}
+
+func (c *searchCounter) Search(ctx context.Context, request *notion.SearchRequest) (*notion.SearchResponse, error) {
+	c.calls++
+	return c.NotionAPI.Search(ctx, request)
+}
+
+// stdout returns what run printed, without colours.
+func stdout(t *testing.T, run func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(out *os.File) { os.Stdout = out }(os.Stdout)
+	os.Stdout = w
+	err = run()
+	w.Close()
+	data, _ := io.ReadAll(r)
+	return colorPattern.ReplaceAllString(string(data), ""), err
+}
+
+// searchFake holds pages and a database, each edited a day after the last.
+func searchFake(t *testing.T) *FakeNotion {
+	f := NewFakeNotion(t)
+	day := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	f.Now = func() time.Time {
+		day = day.Add(24 * time.Hour)
+		return day
+	}
+	root := f.AddPage("", "Workspace", "")
+	for _, title := range []string{"Meeting notes 1", "Meeting notes 2", "Roadmap", "Meeting notes 3"} {
+		f.AddPage(root, title, "")
+	}
+	f.AddDatabase(root, "Meeting log")
+	return f
+}
+
+func TestShowSearch(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  SearchQuery
+		format OutputFormat
+		want   string
+		// calls is the number of pages of results fetched.
+		calls int
+	}{
+		{
+			name:   "only the first page without --all",
+			query:  SearchQuery{Text: "meeting", PageSize: 2},
+			format: OutputText,
+			want:   "▓ Meeting log  database · edited Oct 7 2026\n▓ Meeting notes 3  page · edited Oct 6 2026\n… more results, narrow the query or use --all\n",
+			calls:  1,
+		},
+		{
+			name:   "--all fetches every page",
+			query:  SearchQuery{Text: "meeting", PageSize: 2, All: true},
+			format: OutputText,
+			want:   "▓ Meeting log  database · edited Oct 7 2026\n▓ Meeting notes 3  page · edited Oct 6 2026\n▓ Meeting notes 2  page · edited Oct 4 2026\n▓ Meeting notes 1  page · edited Oct 3 2026\n",
+			calls:  2,
+		},
+		{
+			name:   "no hint when the page holds everything",
+			query:  SearchQuery{Text: "roadmap", PageSize: 2},
+			format: OutputText,
+			want:   "▓ Roadmap  page · edited Oct 5 2026\n",
+			calls:  1,
+		},
+		{
+			name:   "by type",
+			query:  SearchQuery{Type: "page", Text: "meeting", PageSize: 20},
+			format: OutputText,
+			want:   "▓ Meeting notes 3  page · edited Oct 6 2026\n▓ Meeting notes 2  page · edited Oct 4 2026\n▓ Meeting notes 1  page · edited Oct 3 2026\n",
+			calls:  1,
+		},
+		{
+			name:   "nothing found",
+			query:  SearchQuery{Text: "budget", PageSize: 20, All: true},
+			format: OutputText,
+			want:   "nothing found\n",
+			calls:  1,
+		},
+		{
+			name:   "--all as tsv",
+			query:  SearchQuery{Text: "notes", PageSize: 1, All: true},
+			format: OutputTSV,
+			want:   "title\nMeeting notes 3\nMeeting notes 2\nMeeting notes 1\n",
+			calls:  3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &searchCounter{NotionAPI: searchFake(t)}
+			got, err := stdout(t, func() error {
+				return ShowSearch(client, config.LocalParseTemplate{}, tt.query, tt.format, false)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.format == OutputTSV {
+				titles := []string{}
+				for _, line := range strings.Split(strings.TrimSuffix(got, "\n"), "\n") {
+					titles = append(titles, strings.Split(line, "\t")[2])
+				}
+				got = strings.Join(titles, "\n") + "\n"
+			}
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+			if client.calls != tt.calls {
+				t.Errorf("fetched %d pages of results, want %d", client.calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestShowSearchRejects(t *testing.T) {
+	f := searchFake(t)
+	for _, q := range []SearchQuery{
+		{Text: "notes", PageSize: 0},
+		{Text: "notes", PageSize: 101},
+		{Text: "notes", Type: "block", PageSize: 20},
+	} {
+		if err := ShowSearch(f, config.LocalParseTemplate{}, q, OutputText, false); err == nil {
+			t.Errorf("%+v was not rejected", q)
+		}
+	}
+}
+
+func TestEncodeSearch(t *testing.T) {
+	edited := time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)
+	results := []SearchResult{
+		{ID: "p1", Type: "page", Title: "Meeting\tnotes", Icon: "📝", URL: "https://www.notion.so/p1", LastEditedTime: edited},
+		{ID: "d1", Type: "database", Title: "Tasks", URL: "https://www.notion.so/d1", LastEditedTime: edited},
+	}
+	tests := []struct {
+		format OutputFormat
+		want   string
+	}{
+		{OutputJSON, `[
+  {
+    "id": "p1",
+    "type": "page",
+    "title": "Meeting\tnotes",
+    "icon": "📝",
+    "url": "https://www.notion.so/p1",
+    "last_edited_time": "2026-10-16T18:00:00Z"
+  },
+  {
+    "id": "d1",
+    "type": "database",
+    "title": "Tasks",
+    "url": "https://www.notion.so/d1",
+    "last_edited_time": "2026-10-16T18:00:00Z"
+  }
+]
+`},
+		{OutputYAML, `- id: p1
+  type: page
+  title: "Meeting\tnotes"
+  icon: "\U0001F4DD"
+  url: https://www.notion.so/p1
+  last_edited_time: 2026-10-16T18:00:00Z
+- id: d1
+  type: database
+  title: Tasks
+  url: https://www.notion.so/d1
+  last_edited_time: 2026-10-16T18:00:00Z
+`},
+		{OutputTSV, "id\ttype\ttitle\tlast_edited_time\turl\n" +
+			"p1\tpage\tMeeting\\tnotes\t2026-10-16T18:00:00Z\thttps://www.notion.so/p1\n" +
+			"d1\tdatabase\tTasks\t2026-10-16T18:00:00Z\thttps://www.notion.so/d1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := EncodeSearch(&buf, tt.format, results); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAliasFor(t *testing.T) {
+	for title, want := range map[string]string{
+		"Meeting Notes":         "meeting-notes",
+		"  Q3 roadmap — draft ": "q3-roadmap-draft",
+		"read_me-first":         "read_me-first",
+		"🚀 Launch!":             "launch",
+		"Café menu":             "caf-menu",
+		"":                      "",
+	} {
+		if got := aliasFor(title); got != want {
+			t.Errorf("aliasFor(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
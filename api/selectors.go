@@ -0,0 +1,119 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/haykh/nogo/utils"
+
+	notion "github.com/jomei/notionapi"
+)
+
+type Selector struct {
+	Keys  []string
+	Match []string
+	// Filter narrows the entries to pick from; on its own it selects every
+	// matching entry, or the ones picked among them on a terminal.
+	Filter StackQuery
+}
+
+func (s Selector) IsEmpty() bool {
+	return len(s.Keys) == 0 && len(s.Match) == 0 && s.Filter.IsEmpty()
+}
+
+// Interactive reports whether the entries are to be picked in a prompt:
+// nothing was selected, or only a filter was given on a terminal.
+func (s Selector) Interactive() bool {
+	return len(s.Keys) == 0 && len(s.Match) == 0 && (s.Filter.IsEmpty() || utils.IsInteractive())
+}
+
+// Options are the entries to offer in a prompt, narrowed by the filter.
+func (s Selector) Options(blocks notion.Blocks) ([]int, error) {
+	if err := s.Filter.Validate(); err != nil {
+		return nil, err
+	}
+	options := s.Filter.Apply(NewStackEntries(blocks), Now())
+	if len(options) == 0 {
+		return nil, errors.New("no entry matches the filters")
+	}
+	return options, nil
+}
+
+// labels picks the prompt labels of the options.
+func labels(all []string, options []int) []string {
+	picked := []string{}
+	for _, idx := range options {
+		picked = append(picked, all[idx])
+	}
+	return picked
+}
+
+func normalizeID(id string) string {
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
+
+func SelectEntries(blocks notion.Blocks, plain []string, sel Selector) ([]int, error) {
+	selected := []int{}
+	add := func(idx int) {
+		if !utils.IsIn(idx, selected) {
+			selected = append(selected, idx)
+		}
+	}
+	for _, key := range sel.Keys {
+		if idx, err := strconv.Atoi(key); err == nil {
+			if idx < 1 || idx > len(blocks) {
+				return nil, fmt.Errorf("index %d out of range [1, %d]", idx, len(blocks))
+			}
+			add(idx - 1)
+			continue
+		}
+		found := false
+		for i, block := range blocks {
+			if normalizeID(string(block.GetID())) == normalizeID(key) {
+				add(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no entry with index or id `%s`", key)
+		}
+	}
+	for _, match := range sel.Match {
+		found := false
+		for i, pl := range plain {
+			if strings.Contains(strings.ToLower(pl), strings.ToLower(match)) {
+				add(i)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no entry matches `%s`", match)
+		}
+	}
+	if !sel.Filter.IsEmpty() {
+		options, err := sel.Options(blocks)
+		if err != nil {
+			return nil, err
+		}
+		if len(sel.Keys) == 0 && len(sel.Match) == 0 {
+			selected = options
+		} else {
+			narrowed := []int{}
+			for _, idx := range selected {
+				if utils.IsIn(idx, options) {
+					narrowed = append(narrowed, idx)
+				}
+			}
+			if len(narrowed) == 0 {
+				return nil, errors.New("no selected entry matches the filters")
+			}
+			selected = narrowed
+		}
+	}
+	sort.Ints(selected)
+	return selected, nil
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"testing"
+
+	notion "github.com/jomei/notionapi"
+)
+
+func TestSelectByFilter(t *testing.T) {
+	runStackTests(t, []stackTest{
+		{
+			// not on a terminal, where it would only order the prompt
+			name:    "rm sorted without a filter",
+			entries: []notion.Block{todo("buy milk", false), todo("call bob", true)},
+			run: func(client NotionAPI, pageID string) error {
+				return RmFromStack(client, pageID, Selector{Filter: StackQuery{Sort: "due"}})
+			},
+			want:    []string{"[ ] buy milk", "[x] call bob"},
+			wantErr: "no entry selector given",
+		},
+		{
+			name:    "toggle capped without a filter",
+			entries: []notion.Block{todo("buy milk", false), todo("call bob", true)},
+			run: func(client NotionAPI, pageID string) error {
+				return ToggleStack(client, pageID, Selector{Filter: StackQuery{Sort: "priority", Limit: 1}}, false)
+			},
+			want:    []string{"[ ] buy milk", "[x] call bob"},
+			wantErr: "no entry selector given",
+		},
+		{
+			name: "rm of the first matches",
+			entries: []notion.Block{
+				todo("buy milk", false),
+				todo("buy bread", false),
+				todo("buy eggs", false),
+			},
+			run: func(client NotionAPI, pageID string) error {
+				return RmFromStack(client, pageID, Selector{Filter: StackQuery{Grep: "buy", Limit: 2}})
+			},
+			want: []string{"[ ] buy eggs"},
+		},
+		{
+			name: "rm by filter",
+			entries: []notion.Block{
+				todo("buy milk", true),
+				todo("buy bread", false),
+				todo("call bob", true),
+			},
+			run: func(client NotionAPI, pageID string) error {
+				return RmFromStack(client, pageID, Selector{Filter: StackQuery{Done: true, Grep: "buy"}})
+			},
+			want: []string{"[ ] buy bread", "[x] call bob"},
+		},
+	})
+}
+
+func TestSortAloneSelectsNothing(t *testing.T) {
+	blocks := notion.Blocks{todo("buy milk", false), todo("call bob", true)}
+	plain := []string{"buy milk", "call bob"}
+	for _, query := range []StackQuery{{Sort: "due"}, {Sort: "priority"}, {Limit: 1}, {Sort: "due", Limit: 2}} {
+		if selected, err := SelectEntries(blocks, plain, Selector{Filter: query}); err != nil {
+			t.Errorf("%+v: %v", query, err)
+		} else if len(selected) != 0 {
+			t.Errorf("%+v selected entries %v, want none", query, selected)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strings"
 	"unicode/utf8"
 
@@ -69,9 +70,13 @@ func markdownify(rt notion.RichText) string {
 	}
 
 	switch rt.Type {
-	case "text":
+	case "text", "mention":
 		trimmed := strings.Trim(rt.PlainText, " ")
-		decorated := strings.Replace(rt.PlainText, trimmed, prefix+trimmed+suffix, -1)
+		if rt.Type == "mention" && rt.Annotations.Color == notion.ColorDefault {
+			prefix += string(utils.ColorBlue)
+			suffix = string(utils.ColorReset) + suffix
+		}
+		decorated := strings.Replace(rt.PlainText, trimmed, utils.Hyperlink(richTextLink(rt), prefix+trimmed+suffix), -1)
 		return decorated
 	case "equation":
 		return fmt.Sprintf("$ %s $", rt.PlainText)
@@ -80,65 +85,147 @@ func markdownify(rt notion.RichText) string {
 	}
 }
 
-var NumberedListCounter int
+// Blocks2String renders a run of sibling blocks, numbering consecutive
+// numbered list items.
+func Blocks2String(rc RenderContext, blocks notion.Blocks) (string, error) {
+	result := ""
+	number := 0
+	for _, block := range blocks {
+		if block.GetType() == notion.BlockTypeNumberedListItem {
+			number++
+		} else {
+			number = 0
+		}
+		rc.number = number
+		if str, err := Block2String(rc, block); err != nil {
+			return "", err
+		} else {
+			result += str
+		}
+	}
+	return result, nil
+}
 
-func Block2String(c *notion.Client, b notion.Block, level int) (string, error) {
-	if b.GetType() == "numbered_list_item" {
-		defer func() {
-			NumberedListCounter++
-		}()
+// Children2String renders the children of a block.
+func Children2String(rc RenderContext, blockID notion.BlockID) (string, error) {
+	if children, err := GetChildren(rc.Client, blockID); err != nil {
+		return "", err
 	} else {
-		defer func() {
-			NumberedListCounter = 1
-		}()
+		return Blocks2String(rc, children)
 	}
+}
+
+// rendersOwnChildren lists the block types whose stringers lay out their
+// children themselves.
+func rendersOwnChildren(b notion.Block) bool {
+	switch b.GetType() {
+	case "toggle", "column_list", "column", "synced_block", "table", "child_page", "child_database":
+		return true
+	default:
+		return false
+	}
+}
+
+// Block2String renders a block and, for blocks with nested children (e.g.
+// sub-tasks of a to-do), its children indented underneath.
+func Block2String(rc RenderContext, b notion.Block) (string, error) {
+	b = withRichText(b, ResolveMentions(rc.Client, BlockRichText(b)))
+	result, err := block2String(rc, b)
+	if err != nil {
+		return "", err
+	}
+	if b.GetHasChildren() && !rendersOwnChildren(b) {
+		if open, rc := rc.Indented(2).expand(); open {
+			if b.GetType() == notion.BlockTypeNumberedListItem {
+				rc.ListNesting++
+			}
+			if children, err := Children2String(rc, b.GetID()); err != nil {
+				return "", err
+			} else {
+				result += children
+			}
+		}
+	}
+	return rc.finish(result), nil
+}
+
+func block2String(rc RenderContext, b notion.Block) (string, error) {
 	switch b.GetType() {
 	case "heading_1", "heading_2", "heading_3":
-		return Heading2String(b, level), nil
+		return Heading2String(rc, b), nil
 	case "paragraph":
-		return Paragraph2String(b, level), nil
+		return Paragraph2String(rc, b), nil
 	case "to_do":
-		return ToDo2String(b, level), nil
+		return ToDo2String(rc, b), nil
 	case "bulleted_list_item":
-		return BulletedListItem2String(b, level), nil
+		return BulletedListItem2String(rc, b), nil
 	case "numbered_list_item":
-		return NumberedListItem2String(b, level), nil
+		return NumberedListItem2String(rc, b), nil
 	case "toggle":
-		return Toggle2String(c, b, true, level)
+		return Toggle2String(rc, b)
 	case "equation":
-		return Equation2String(b, level), nil
+		return Equation2String(rc, b), nil
 	case "code":
-		return Code2String(b, level), nil
+		return Code2String(rc, b), nil
 	case "divider":
-		return Divider2String(b, level), nil
+		return Divider2String(rc, b), nil
 	case "column_list":
-		return ColumnList2String(c, b, level)
+		return ColumnList2String(rc, b)
 	case "column":
-		return Column2String(c, b, level)
+		return Column2String(rc, b)
 	case "image":
-		return Image2String(b, level), nil
+		return Image2String(rc, b), nil
 	case "child_page":
-		return ChildPage2String(b, level), nil
+		return ChildPage2String(rc, b)
 	case "synced_block":
-		if blocks, err := c.Block.GetChildren(context.Background(), notion.BlockID(b.(*notion.SyncedBlock).ID), nil); err != nil {
-			return "", err
-		} else {
-			result := ""
-			for _, block := range blocks.Results {
-				if str, err := Block2String(c, block, level); err != nil {
-					return "", err
-				} else {
-					result += str
-				}
-			}
-			return result, nil
-		}
+		return Children2String(rc, b.GetID())
+	case "quote":
+		return Quote2String(rc, b), nil
+	case "callout":
+		return Callout2String(rc, b), nil
+	case "table":
+		return Table2String(rc, b)
+	case "bookmark":
+		bm := b.(*notion.BookmarkBlock).Bookmark
+		return Link2String(rc, "bookmark", bm.URL, bm.Caption), nil
+	case "embed":
+		embed := b.(*notion.EmbedBlock).Embed
+		return Link2String(rc, "embed", embed.URL, embed.Caption), nil
+	case "link_preview":
+		return Link2String(rc, "link", b.(*notion.LinkPreviewBlock).LinkPreview.URL, nil), nil
+	case "video":
+		video := b.(*notion.VideoBlock).Video
+		return Link2String(rc, "video", FileURL(video.Type, video.File, video.External), video.Caption), nil
+	case "audio":
+		audio := b.(*notion.AudioBlock).Audio
+		return Link2String(rc, "audio", FileURL(audio.Type, audio.File, audio.External), audio.Caption), nil
+	case "file":
+		file := b.(*notion.FileBlock).File
+		return Link2String(rc, "file", FileURL(file.Type, file.File, file.External), file.Caption), nil
+	case "pdf":
+		pdf := b.(*notion.PdfBlock).Pdf
+		return Link2String(rc, "pdf", FileURL(pdf.Type, pdf.File, pdf.External), pdf.Caption), nil
+	case "link_to_page":
+		return LinkToPage2String(rc, b)
+	case "child_database":
+		return indent("▦ "+b.(*notion.ChildDatabaseBlock).ChildDatabase.Title, rc.Level) + "\n", nil
+	case "template":
+		return RichText2String(rc, b.(*notion.TemplateBlock).Template.RichText, "⧉ "), nil
+	case "table_of_contents":
+		return Placeholder2String(rc, "table of contents"), nil
+	case "breadcrumb":
+		return Placeholder2String(rc, "breadcrumb"), nil
+	case "table_row":
+		return TableRow2String(rc, b), nil
 	default:
-		return "", fmt.Errorf("unknown block type: %s", b.GetType())
+		if b.GetType() == "" || b.GetType() == "unsupported" {
+			return Placeholder2String(rc, "unsupported block"), nil
+		}
+		return Placeholder2String(rc, fmt.Sprintf("unsupported block: %s", b.GetType())), nil
 	}
 }
 
-func RichText2String(rts []notion.RichText, prefix string, level int, style ...utils.TextStyle) string {
+func RichText2String(rc RenderContext, rts []notion.RichText, prefix string, style ...utils.TextStyle) string {
 	reset_all := utils.ColorReset + utils.HiReset
 	result := ""
 	if len(style) > 0 {
@@ -152,34 +239,41 @@ func RichText2String(rts []notion.RichText, prefix string, level int, style ...u
 			plain += markdownify(rt)
 		}
 		nprefix := utf8.RuneCountInString(prefix)
-		result += indent(padLinebreak(plain, nprefix), level)
+		result += indent(padLinebreak(plain, nprefix), rc.Level)
 	} else {
-		result += indent(prefix, level)
+		result += indent(prefix, rc.Level)
 	}
 	if len(style) > 0 {
 		result += reset_all
 	}
-	return result + "\n"
+	return rc.finish(result + "\n")
 }
 
-func Title2String(title *notion.TitleProperty) string {
+func Title2String(rc RenderContext, title *notion.TitleProperty) string {
 	richtext := title.Title[0]
-	return RichText2String([]notion.RichText{richtext}, "▓ ", 0, utils.ColorCyan) + "\n"
+	return RichText2String(rc, []notion.RichText{richtext}, "▓ ", utils.ColorCyan) + "\n"
 }
 
-func PageTitle2String(page *notion.Page) string {
-	title := page.Properties["title"].(*notion.TitleProperty)
+// PageTitle2String renders the title of a page (of a database row too, whose
+// title property has another name) after its emoji icon.
+func PageTitle2String(rc RenderContext, page *notion.Page) string {
+	title := textSpan("Untitled", notion.ColorDefault)
+	for _, prop := range page.Properties {
+		if prop, ok := prop.(*notion.TitleProperty); ok && len(prop.Title) > 0 {
+			title = prop.Title[0]
+		}
+	}
 	if (page.Icon != nil) && (page.Icon.Type == "emoji") {
-		title.Title[0].PlainText = fmt.Sprintf("%s  %s", string(*page.Icon.Emoji), title.Title[0].PlainText)
+		title.PlainText = fmt.Sprintf("%s  %s", string(*page.Icon.Emoji), title.PlainText)
 	}
-	return Title2String(title)
+	return Title2String(rc, &notion.TitleProperty{Title: []notion.RichText{title}})
 }
 
-func Paragraph2String(b notion.Block, level int) string {
-	return RichText2String(b.(*notion.ParagraphBlock).Paragraph.RichText, "", level)
+func Paragraph2String(rc RenderContext, b notion.Block) string {
+	return RichText2String(rc, b.(*notion.ParagraphBlock).Paragraph.RichText, "")
 }
 
-func ToDo2String(b notion.Block, level int) string {
+func ToDo2String(rc RenderContext, b notion.Block) string {
 	todo := b.(*notion.ToDoBlock).ToDo
 	var check string
 	if todo.Checked {
@@ -187,92 +281,102 @@ func ToDo2String(b notion.Block, level int) string {
 	} else {
 		check = " "
 	}
-	return RichText2String(todo.RichText, fmt.Sprintf("[%s] ", check), level)
+	rts := todo.RichText
+	if !todo.Checked && ParseEntryMeta(rts).Overdue(Now()) {
+		rts = recolor(rts, notion.ColorRed)
+	}
+	return RichText2String(rc, rts, fmt.Sprintf("[%s] ", check))
 }
 
-func Heading2String(b interface{}, level int) string {
+// recolor copies rich text, giving the spans without a colour of their own
+// the given one.
+func recolor(rts []notion.RichText, color notion.Color) []notion.RichText {
+	colored := make([]notion.RichText, len(rts))
+	for i, rt := range rts {
+		annotations := notion.Annotations{}
+		if rt.Annotations != nil {
+			annotations = *rt.Annotations
+		}
+		if annotations.Color == "" || annotations.Color == notion.ColorDefault {
+			annotations.Color = color
+		}
+		rt.Annotations = &annotations
+		colored[i] = rt
+	}
+	return colored
+}
+
+func Heading2String(rc RenderContext, b interface{}) string {
 	switch b := b.(type) {
 	case *notion.Heading1Block:
-		return RichText2String(b.Heading1.RichText, "# ", level)
+		return RichText2String(rc, b.Heading1.RichText, "# ")
 	case *notion.Heading2Block:
-		return RichText2String(b.Heading2.RichText, "## ", level)
+		return RichText2String(rc, b.Heading2.RichText, "## ")
 	case *notion.Heading3Block:
-		return RichText2String(b.Heading3.RichText, "### ", level)
+		return RichText2String(rc, b.Heading3.RichText, "### ")
 	default:
 		return ""
 	}
 }
 
-func BulletedListItem2String(b notion.Block, level int) string {
-	return RichText2String(b.(*notion.BulletedListItemBlock).BulletedListItem.RichText, "* ", level)
+func BulletedListItem2String(rc RenderContext, b notion.Block) string {
+	return RichText2String(rc, b.(*notion.BulletedListItemBlock).BulletedListItem.RichText, "* ")
 }
 
-func NumberedListItem2String(b notion.Block, level int) string {
+func NumberedListItem2String(rc RenderContext, b notion.Block) string {
 	num := b.(*notion.NumberedListItemBlock).NumberedListItem
-	prefix := fmt.Sprintf("%d. ", NumberedListCounter)
-	return RichText2String(num.RichText, prefix, level)
+	prefix := ListMarker(max(rc.number, 1), rc.ListNesting) + " "
+	return RichText2String(rc, num.RichText, prefix)
 }
 
-func Toggle2String(c *notion.Client, b notion.Block, open bool, level int) (string, error) {
+func Toggle2String(rc RenderContext, b notion.Block) (string, error) {
 	tblock := b.(*notion.ToggleBlock)
 	toggle := tblock.Toggle
+	open, inner := rc.Indented(2).expand()
 	var icon string
 	if open {
 		icon = "▼"
 	} else {
 		icon = "▶"
 	}
-	result := RichText2String(toggle.RichText, fmt.Sprintf("%s ", icon), level)
+	result := RichText2String(rc, toggle.RichText, fmt.Sprintf("%s ", icon))
 	if open && tblock.HasChildren {
-		children, err := c.Block.GetChildren(context.Background(), notion.BlockID(b.(*notion.ToggleBlock).ID), nil)
-		if err != nil {
+		if children, err := Children2String(inner, tblock.GetID()); err != nil {
 			return "", err
-		}
-		for _, child := range children.Results {
-			if bl, err := Block2String(c, child, level+2); err != nil {
-				return "", err
-			} else {
-				result += bl
-			}
+		} else {
+			result += children
 		}
 	}
 	return result, nil
 }
 
-func Equation2String(b notion.Block, level int) string {
+func Equation2String(rc RenderContext, b notion.Block) string {
 	eqblock := b.(*notion.EquationBlock)
 	equation := eqblock.Equation
-	return indent(fmt.Sprintf("$$ %s $$", equation.Expression), level)
+	return indent(fmt.Sprintf("$$ %s $$", equation.Expression), rc.Level) + "\n"
 }
 
-func Code2String(b notion.Block, level int) string {
+func Code2String(rc RenderContext, b notion.Block) string {
 	code := b.(*notion.CodeBlock).Code
 	lang := code.Language
-	result := indent(fmt.Sprintf("```%s", lang), level)
-	result += RichText2String(code.RichText, "", level)
-	result += indent("```", level)
+	result := indent(fmt.Sprintf("```%s", lang), rc.Level) + "\n"
+	result += RichText2String(rc, code.RichText, "")
+	result += indent("```", rc.Level) + "\n"
 	return result
 }
 
-func Divider2String(b notion.Block, level int) string {
-	return indent("---", level)
+func Divider2String(rc RenderContext, b notion.Block) string {
+	return indent(rc.rule(), rc.Level) + "\n"
 }
 
-func Column2String(c *notion.Client, b notion.Block, level int) (string, error) {
+func Column2String(rc RenderContext, b notion.Block) (string, error) {
 	col := b.(*notion.ColumnBlock)
 	result := ""
 	if col.HasChildren {
-		blockID := notion.BlockID(col.ID)
-		if children, err := c.Block.GetChildren(context.Background(), blockID, nil); err != nil {
+		if children, err := Children2String(rc.Indented(2), col.ID); err != nil {
 			return "", err
 		} else {
-			for _, child := range children.Results {
-				if bl, err := Block2String(c, child, level+2); err != nil {
-					return "", err
-				} else {
-					result += bl
-				}
-			}
+			result += children
 		}
 	} else {
 		result += "\n"
@@ -280,21 +384,18 @@ func Column2String(c *notion.Client, b notion.Block, level int) (string, error)
 	return result, nil
 }
 
-func ColumnList2String(c *notion.Client, b notion.Block, level int) (string, error) {
+// ColumnList2String spends one level of depth on the whole column list; the
+// columns themselves are only layout and pass it through.
+func ColumnList2String(rc RenderContext, b notion.Block) (string, error) {
 	clist := b.(*notion.ColumnListBlock)
 	result := ""
-	if clist.HasChildren {
-		blockID := notion.BlockID(clist.ID)
-		if children, err := c.Block.GetChildren(context.Background(), blockID, nil); err != nil {
+	if open, inner := rc.expand(); !open {
+		result += indent(utils.HiDim+"░ columns"+utils.HiReset, rc.Level) + "\n"
+	} else if clist.HasChildren {
+		if children, err := Children2String(inner, clist.ID); err != nil {
 			return "", err
 		} else {
-			for _, child := range children.Results {
-				if bl, err := Block2String(c, child, level); err != nil {
-					return "", err
-				} else {
-					result += bl
-				}
-			}
+			result += children
 		}
 	} else {
 		result += "\n"
@@ -302,7 +403,7 @@ func ColumnList2String(c *notion.Client, b notion.Block, level int) (string, err
 	return result, nil
 }
 
-func Image2String(b notion.Block, level int) string {
+func Image2String(rc RenderContext, b notion.Block) string {
 	img := b.(*notion.ImageBlock).Image
 	url := ""
 	if img.Type == "external" {
@@ -312,10 +413,135 @@ func Image2String(b notion.Block, level int) string {
 	} else {
 		url = string(img.Type)
 	}
-	return indent(fmt.Sprintf("![](%s)", url), level)
+	return indent(fmt.Sprintf("![](%s)", url), rc.Level) + "\n"
 }
 
-func ChildPage2String(b notion.Block, level int) string {
+// ChildPage2String only descends into the child page when an explicit depth
+// allows it; an unlimited depth would walk the whole workspace.
+func ChildPage2String(rc RenderContext, b notion.Block) (string, error) {
 	child := b.(*notion.ChildPageBlock).ChildPage
-	return indent("░ "+child.Title, level)
+	result := indent("░ "+child.Title, rc.Level) + "\n"
+	if open, inner := rc.Indented(2).expand(); open && rc.Depth >= 0 {
+		inner.ListNesting = 0
+		if children, err := Children2String(inner, b.GetID()); err != nil {
+			return "", err
+		} else {
+			result += children
+		}
+	}
+	return result, nil
+}
+
+func Placeholder2String(rc RenderContext, what string) string {
+	return indent(utils.HiDim+"["+what+"]"+utils.HiReset, rc.Level) + "\n"
+}
+
+func Quote2String(rc RenderContext, b notion.Block) string {
+	text := strings.TrimSuffix(RichText2String(rc.Indented(-rc.Level), b.(*notion.QuoteBlock).Quote.RichText, ""), "\n")
+	return indent("> "+strings.ReplaceAll(text, "\n", "\n> "), rc.Level) + "\n"
+}
+
+func Callout2String(rc RenderContext, b notion.Block) string {
+	callout := b.(*notion.CalloutBlock).Callout
+	icon := "💡"
+	if callout.Icon != nil && callout.Icon.Emoji != nil {
+		icon = string(*callout.Icon.Emoji)
+	}
+	return RichText2String(rc, callout.RichText, icon+" ")
+}
+
+func Link2String(rc RenderContext, kind, url string, caption []notion.RichText) string {
+	result := fmt.Sprintf("[%s] %s%s%s", kind, utils.ColorBlue, utils.Hyperlink(url, url), utils.ColorReset)
+	if plain := RichText2Plain(caption); plain != "" {
+		result += " — " + plain
+	}
+	return indent(result, rc.Level) + "\n"
+}
+
+func LinkToPage2String(rc RenderContext, b notion.Block) (string, error) {
+	link := b.(*notion.LinkToPageBlock).LinkToPage
+	title := ""
+	if link.DatabaseID != "" {
+		if db, err := rc.Client.GetDatabase(context.Background(), link.DatabaseID); err != nil {
+			return "", err
+		} else {
+			title = "▦ " + RichText2Plain(db.Title)
+		}
+	} else {
+		if page, err := rc.Client.GetPage(context.Background(), link.PageID); err != nil {
+			return "", err
+		} else {
+			title = "░ " + PageTitle(page)
+		}
+	}
+	return indent("→ "+title, rc.Level) + "\n", nil
+}
+
+var escapePattern = regexp.MustCompile("\033\\[[0-9;]*m|\033\\]8;[^\033]*\033\\\\")
+
+func visibleWidth(s string) int {
+	return utf8.RuneCountInString(escapePattern.ReplaceAllString(s, ""))
+}
+
+func tableCells(rc RenderContext, row *notion.TableRowBlock) []string {
+	cells := []string{}
+	for _, cell := range row.TableRow.Cells {
+		text := ""
+		for _, rt := range ResolveMentions(rc.Client, cell) {
+			text += markdownify(rt)
+		}
+		cells = append(cells, strings.ReplaceAll(text, "\n", " "))
+	}
+	return cells
+}
+
+func TableRow2String(rc RenderContext, b notion.Block) string {
+	return indent("│ "+strings.Join(tableCells(rc, b.(*notion.TableRowBlock)), " │ ")+" │", rc.Level) + "\n"
+}
+
+// Table2String draws the table with box characters, padding every column to
+// its widest (escape-code free) cell.
+func Table2String(rc RenderContext, b notion.Block) (string, error) {
+	table := b.(*notion.TableBlock).Table
+	rows, err := GetChildren(rc.Client, b.GetID())
+	if err != nil {
+		return "", err
+	}
+	cells := [][]string{}
+	widths := make([]int, table.TableWidth)
+	for _, row := range rows {
+		if row, ok := row.(*notion.TableRowBlock); ok {
+			rowCells := tableCells(rc, row)
+			for len(rowCells) < table.TableWidth {
+				rowCells = append(rowCells, "")
+			}
+			for i, cell := range rowCells[:table.TableWidth] {
+				widths[i] = max(widths[i], visibleWidth(cell))
+			}
+			cells = append(cells, rowCells[:table.TableWidth])
+		}
+	}
+	rule := func(left, mid, right string) string {
+		segments := []string{}
+		for _, w := range widths {
+			segments = append(segments, strings.Repeat("─", w+2))
+		}
+		return indent(left+strings.Join(segments, mid)+right, rc.Level) + "\n"
+	}
+	result := rule("┌", "┬", "┐")
+	for r, row := range cells {
+		line := "│"
+		for i, cell := range row {
+			pad := widths[i] - visibleWidth(cell)
+			if table.HasRowHeader && i == 0 {
+				cell = utils.ColorCyan + cell + utils.ColorReset
+			}
+			line += " " + cell + strings.Repeat(" ", pad) + " │"
+		}
+		result += indent(line, rc.Level) + "\n"
+		if r == 0 && table.HasColumnHeader && len(cells) > 1 {
+			result += rule("├", "┼", "┤")
+		}
+	}
+	return result + rule("└", "┴", "┘"), nil
 }
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/haykh/nogo/utils"
+	notion "github.com/jomei/notionapi"
+)
+
+func text(s string) []notion.RichText {
+	return []notion.RichText{textSpan(s, notion.ColorDefault)}
+}
+
+func paragraph(s string) *notion.ParagraphBlock {
+	return &notion.ParagraphBlock{BasicBlock: basic(notion.BlockTypeParagraph), Paragraph: notion.Paragraph{RichText: text(s)}}
+}
+
+func numbered(s string, children ...notion.Block) *notion.NumberedListItemBlock {
+	return &notion.NumberedListItemBlock{
+		BasicBlock:       basic(notion.BlockTypeNumberedListItem),
+		NumberedListItem: notion.ListItem{RichText: text(s), Children: children},
+	}
+}
+
+func tableRow(cells ...string) *notion.TableRowBlock {
+	row := &notion.TableRowBlock{BasicBlock: basic(notion.BlockTypeTableRowBlock)}
+	for _, cell := range cells {
+		row.TableRow.Cells = append(row.TableRow.Cells, text(cell))
+	}
+	return row
+}
+
+func TestBlocks2String(t *testing.T) {
+	styled := func(s string, annotations notion.Annotations) notion.RichText {
+		rt := textSpan(s, notion.ColorDefault)
+		rt.Annotations = &annotations
+		return rt
+	}
+	icon := notion.Emoji("📌")
+	tests := []struct {
+		name   string
+		blocks []notion.Block
+		// collapsed renders with depth 0: nothing nested is expanded
+		collapsed bool
+		want      string
+	}{
+		{
+			name:   "paragraph",
+			blocks: []notion.Block{paragraph("hello world")},
+			want:   "hello world\n",
+		},
+		{
+			name: "annotations",
+			blocks: []notion.Block{&notion.ParagraphBlock{
+				BasicBlock: basic(notion.BlockTypeParagraph),
+				Paragraph: notion.Paragraph{RichText: []notion.RichText{
+					styled("bold", notion.Annotations{Bold: true}),
+					textSpan(" and ", notion.ColorDefault),
+					styled("code", notion.Annotations{Code: true}),
+					textSpan(" and ", notion.ColorDefault),
+					styled("gone", notion.Annotations{Strikethrough: true}),
+				}},
+			}},
+			want: "**bold** and `code` and ~~gone~~\n",
+		},
+		{
+			name: "headings",
+			blocks: []notion.Block{
+				&notion.Heading1Block{BasicBlock: basic(notion.BlockTypeHeading1), Heading1: notion.Heading{RichText: text("one")}},
+				&notion.Heading2Block{BasicBlock: basic(notion.BlockTypeHeading2), Heading2: notion.Heading{RichText: text("two")}},
+				&notion.Heading3Block{BasicBlock: basic(notion.BlockTypeHeading3), Heading3: notion.Heading{RichText: text("three")}},
+			},
+			want: "# one\n## two\n### three\n",
+		},
+		{
+			name:   "to-dos with sub-tasks",
+			blocks: []notion.Block{todo("release", false, todo("tag", true)), todo("done", true)},
+			want:   "[ ] release\n  [✓] tag\n[✓] done\n",
+		},
+		{
+			name: "bulleted list",
+			blocks: []notion.Block{
+				&notion.BulletedListItemBlock{BasicBlock: basic(notion.BlockTypeBulletedListItem), BulletedListItem: notion.ListItem{RichText: text("milk")}},
+				&notion.BulletedListItemBlock{BasicBlock: basic(notion.BlockTypeBulletedListItem), BulletedListItem: notion.ListItem{RichText: text("bread")}},
+			},
+			want: "* milk\n* bread\n",
+		},
+		{
+			name: "numbered lists restart and nest",
+			blocks: []notion.Block{
+				numbered("one", numbered("sub one"), numbered("sub two", numbered("deep"))),
+				numbered("two"),
+				paragraph("break"),
+				numbered("again"),
+			},
+			want: "1. one\n  a. sub one\n  b. sub two\n    i. deep\n2. two\nbreak\n1. again\n",
+		},
+		{
+			name: "toggle",
+			blocks: []notion.Block{&notion.ToggleBlock{
+				BasicBlock: basic(notion.BlockTypeToggle),
+				Toggle:     notion.Toggle{RichText: text("details"), Children: notion.Blocks{paragraph("hidden")}},
+			}},
+			want: "▼ details\n  hidden\n",
+		},
+		{
+			name: "collapsed toggle",
+			blocks: []notion.Block{&notion.ToggleBlock{
+				BasicBlock: basic(notion.BlockTypeToggle),
+				Toggle:     notion.Toggle{RichText: text("details"), Children: notion.Blocks{paragraph("hidden")}},
+			}},
+			collapsed: true,
+			want:      "▶ details\n",
+		},
+		{
+			name:   "equation",
+			blocks: []notion.Block{&notion.EquationBlock{BasicBlock: basic(notion.BlockTypeEquation), Equation: notion.Equation{Expression: "e^{i\\pi} = -1"}}},
+			want:   "$$ e^{i\\pi} = -1 $$\n",
+		},
+		{
+			name:   "code",
+			blocks: []notion.Block{&notion.CodeBlock{BasicBlock: basic(notion.BlockTypeCode), Code: notion.Code{RichText: text("fmt.Println(1)"), Language: "go"}}},
+			want:   "```go\nfmt.Println(1)\n```\n",
+		},
+		{
+			name:   "divider",
+			blocks: []notion.Block{&notion.DividerBlock{BasicBlock: basic(notion.BlockTypeDivider)}},
+			want:   strings.Repeat("─", 20) + "\n",
+		},
+		{
+			name:   "quote",
+			blocks: []notion.Block{&notion.QuoteBlock{BasicBlock: basic(notion.BlockQuote), Quote: notion.Quote{RichText: text("to be\nor not")}}},
+			want:   "> to be\n> or not\n",
+		},
+		{
+			name: "callout",
+			blocks: []notion.Block{
+				&notion.CalloutBlock{BasicBlock: basic(notion.BlockCallout), Callout: notion.Callout{RichText: text("note")}},
+				&notion.CalloutBlock{BasicBlock: basic(notion.BlockCallout), Callout: notion.Callout{RichText: text("pinned"), Icon: &notion.Icon{Type: "emoji", Emoji: &icon}}},
+			},
+			want: "💡 note\n📌 pinned\n",
+		},
+		{
+			name: "image",
+			blocks: []notion.Block{&notion.ImageBlock{
+				BasicBlock: basic(notion.BlockTypeImage),
+				Image:      notion.Image{Type: "external", External: &notion.FileObject{URL: "https://example.com/cat.png"}},
+			}},
+			want: "![](https://example.com/cat.png)\n",
+		},
+		{
+			name: "bookmark",
+			blocks: []notion.Block{&notion.BookmarkBlock{
+				BasicBlock: basic(notion.BlockTypeBookmark),
+				Bookmark:   notion.Bookmark{URL: "https://example.com", Caption: text("example")},
+			}},
+			want: "[bookmark] https://example.com — example\n",
+		},
+		{
+			name: "columns",
+			blocks: []notion.Block{&notion.ColumnListBlock{
+				BasicBlock: basic(notion.BlockTypeColumnList),
+				ColumnList: notion.ColumnList{Children: notion.Blocks{
+					&notion.ColumnBlock{BasicBlock: basic(notion.BlockTypeColumn), Column: notion.Column{Children: notion.Blocks{paragraph("left")}}},
+					&notion.ColumnBlock{BasicBlock: basic(notion.BlockTypeColumn), Column: notion.Column{Children: notion.Blocks{paragraph("right")}}},
+				}},
+			}},
+			want: "  left\n  right\n",
+		},
+		{
+			name: "collapsed columns",
+			blocks: []notion.Block{&notion.ColumnListBlock{
+				BasicBlock: basic(notion.BlockTypeColumnList),
+				ColumnList: notion.ColumnList{Children: notion.Blocks{
+					&notion.ColumnBlock{BasicBlock: basic(notion.BlockTypeColumn), Column: notion.Column{Children: notion.Blocks{paragraph("left")}}},
+				}},
+			}},
+			collapsed: true,
+			want:      "░ columns\n",
+		},
+		{
+			name: "table",
+			blocks: []notion.Block{&notion.TableBlock{
+				BasicBlock: basic(notion.BlockTypeTableBlock),
+				Table: notion.Table{
+					TableWidth:      2,
+					HasColumnHeader: true,
+					Children:        notion.Blocks{tableRow("name", "qty"), tableRow("milk", "2"), tableRow("bread")},
+				},
+			}},
+			want: "┌───────┬─────┐\n" +
+				"│ name  │ qty │\n" +
+				"├───────┼─────┤\n" +
+				"│ milk  │ 2   │\n" +
+				"│ bread │     │\n" +
+				"└───────┴─────┘\n",
+		},
+		{
+			name:   "placeholders",
+			blocks: []notion.Block{&notion.BreadcrumbBlock{BasicBlock: basic(notion.BlockTypeBreadcrumb)}, &notion.UnsupportedBlock{BasicBlock: basic(notion.BlockTypeUnsupported)}},
+			want:   "[breadcrumb]\n[unsupported block]\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFakeNotion(t)
+			page := f.AddPage("", "Page", "")
+			f.AddBlocks(notion.BlockID(page), tt.blocks...)
+			rc := RenderContext{Client: f, Depth: -1, Width: 20}
+			if tt.collapsed {
+				rc.Depth = 0
+			}
+			if got, err := Children2String(rc, notion.BlockID(page)); err != nil {
+				t.Fatal(err)
+			} else if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageRenderers(t *testing.T) {
+	f := NewFakeNotion(t)
+	root := f.AddPage("", "Root", "🏠")
+	child := f.AddPage(root, "Child", "")
+	f.AddBlocks(notion.BlockID(child), paragraph("inside"))
+	f.AddBlocks(notion.BlockID(root), &notion.LinkToPageBlock{
+		BasicBlock: basic(notion.BlockTypeLinkToPage),
+		LinkToPage: notion.LinkToPage{Type: "page_id", PageID: child},
+	})
+	page, err := f.GetPage(context.Background(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := RenderContext{Client: f, Depth: -1}
+	if got, want := PageTitle2String(rc, page), "▓ 🏠  Root\n\n"; got != want {
+		t.Errorf("PageTitle2String: got %q, want %q", got, want)
+	}
+	tests := []struct {
+		name  string
+		depth int
+		want  string
+	}{
+		{"child pages are not walked by default", -1, "░ Child\n→ ░ Child\n"},
+		{"an explicit depth walks child pages", 1, "░ Child\n  inside\n→ ░ Child\n"},
+		{"depth zero stops at the child page", 0, "░ Child\n→ ░ Child\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc.Depth = tt.depth
+			if got, err := Children2String(rc, notion.BlockID(root)); err != nil {
+				t.Fatal(err)
+			} else if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderingLeavesBlocksAlone(t *testing.T) {
+	f := NewFakeNotion(t)
+	plans := f.AddPage("", "Plans", "")
+	mention := func() []notion.RichText {
+		return []notion.RichText{
+			textSpan("see ", notion.ColorDefault),
+			{Type: "mention", PlainText: "Untitled", Annotations: &notion.Annotations{Color: notion.ColorDefault}, Mention: &notion.Mention{Type: "page", Page: &notion.PageMention{ID: notion.ObjectID(plans)}}},
+		}
+	}
+	entry := todo("", false)
+	entry.ToDo.RichText = mention()
+	row := &notion.TableRowBlock{BasicBlock: basic(notion.BlockTypeTableRowBlock)}
+	row.TableRow.Cells = [][]notion.RichText{mention()}
+	rc := RenderContext{Client: f, Depth: 0}
+
+	if got, err := Block2String(rc, entry); err != nil {
+		t.Fatal(err)
+	} else if got != "[ ] see Plans\n" {
+		t.Errorf("got %q, want the mention resolved to the page title", got)
+	}
+	if got := utils.Clean(TableRow2String(rc, row)); got != "│ see Plans │" {
+		t.Errorf("got %q, want the mention resolved to the page title", got)
+	}
+	for name, rts := range map[string][]notion.RichText{"to-do": entry.ToDo.RichText, "table cell": row.TableRow.Cells[0]} {
+		if !reflect.DeepEqual(rts, mention()) {
+			t.Errorf("rendering the %s rewrote its rich text to %q", name, RichText2Plain(rts))
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/haykh/nogo/utils"
+
+	notion "github.com/jomei/notionapi"
+)
+
+type ChangeKind string
+
+const (
+	ChangeCreated ChangeKind = "created"
+	ChangeUpdated ChangeKind = "updated"
+	ChangeDeleted ChangeKind = "deleted"
+)
+
+// historySize is the number of commands `nogo undo` can go back.
+const historySize = 50
+
+// Change is a single write a command made to notion.
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+	// BlockID is the created, updated or deleted block (or page).
+	BlockID notion.BlockID `json:"block_id"`
+	// Text is the plain text of the block, to list the change with.
+	Text string `json:"text,omitempty"`
+	// Before and After are the block around an update; undoing it refuses to
+	// overwrite later edits, i.e. content other than After.
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// Operation is everything one command changed, undone as a whole.
+type Operation struct {
+	Command string    `json:"command"`
+	Time    time.Time `json:"time"`
+	Changes []Change  `json:"changes"`
+}
+
+type History struct {
+	path       string
+	Operations []Operation `json:"operations"`
+}
+
+func LoadHistory() (*History, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	h := &History{path: filepath.Join(dir, "history.json")}
+	if data, err := os.ReadFile(h.path); err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, err
+	} else if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("corrupt history %s: %w", h.path, err)
+	}
+	return h, nil
+}
+
+func (h *History) Save() error {
+	if len(h.Operations) == 0 {
+		if err := os.Remove(h.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if len(h.Operations) > historySize {
+		h.Operations = h.Operations[len(h.Operations)-historySize:]
+	}
+	if data, err := json.MarshalIndent(h, "", "  "); err != nil {
+		return err
+	} else if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	} else {
+		return os.WriteFile(h.path, data, 0600)
+	}
+}
+
+// recorded collects the changes of the running command until SaveHistory.
+var recorded struct {
+	sync.Mutex
+	changes []Change
+}
+
+func record(change Change) {
+	recorded.Lock()
+	defer recorded.Unlock()
+	recorded.changes = append(recorded.changes, change)
+}
+
+// SaveHistory stores the changes the command made, if any, as one operation
+// for `nogo undo`; a dry run has none to store.
+func SaveHistory(command string) error {
+	recorded.Lock()
+	changes := recorded.changes
+	recorded.changes = nil
+	recorded.Unlock()
+	if len(changes) == 0 || DryRun {
+		return nil
+	}
+	h, err := LoadHistory()
+	if err != nil {
+		return err
+	}
+	h.Operations = append(h.Operations, Operation{Command: command, Time: time.Now(), Changes: changes})
+	return h.Save()
+}
+
+// historyClient records every write that reaches notion. It sits below the
+// cache, so changes queued offline are recorded once `nogo sync` sends them.
+type historyClient struct {
+	NotionAPI
+}
+
+func (c historyClient) AppendBlockChildren(ctx context.Context, id notion.BlockID, request *notion.AppendBlockChildrenRequest) (*notion.AppendBlockChildrenResponse, error) {
+	response, err := c.NotionAPI.AppendBlockChildren(ctx, id, request)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range response.Results {
+		record(Change{Kind: ChangeCreated, BlockID: b.GetID(), Text: RichText2Plain(BlockRichText(b))})
+	}
+	return response, nil
+}
+
+// beforeKey carries the block an update starts from (see withBefore).
+type beforeKey struct{}
+
+// withBefore passes the block as last read by the command along with its
+// update, so that the history need not fetch it again to record it.
+func withBefore(ctx context.Context, b notion.Block) context.Context {
+	return context.WithValue(ctx, beforeKey{}, b)
+}
+
+func (c historyClient) UpdateBlock(ctx context.Context, id notion.BlockID, request *notion.BlockUpdateRequest) (notion.Block, error) {
+	before, ok := ctx.Value(beforeKey{}).(notion.Block)
+	if !ok || before.GetID() != id {
+		var err error
+		if before, err = c.NotionAPI.GetBlock(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	block, err := c.NotionAPI.UpdateBlock(ctx, id, request)
+	if err != nil {
+		return nil, err
+	}
+	change := Change{Kind: ChangeUpdated, BlockID: id, Text: RichText2Plain(BlockRichText(before))}
+	if change.Before, err = json.Marshal(before); err != nil {
+		return nil, err
+	} else if change.After, err = json.Marshal(block); err != nil {
+		return nil, err
+	}
+	record(change)
+	return block, nil
+}
+
+func (c historyClient) DeleteBlock(ctx context.Context, id notion.BlockID) (notion.Block, error) {
+	block, err := c.NotionAPI.DeleteBlock(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	record(Change{Kind: ChangeDeleted, BlockID: id, Text: RichText2Plain(BlockRichText(block))})
+	return block, nil
+}
+
+func (c historyClient) CreatePage(ctx context.Context, request *notion.PageCreateRequest) (*notion.Page, error) {
+	page, err := c.NotionAPI.CreatePage(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	record(Change{Kind: ChangeCreated, BlockID: notion.BlockID(page.ID), Text: PageTitle(page)})
+	return page, nil
+}
+
+// updateRequest is the update that sets the content of a block back to b.
+func updateRequest(b notion.Block) (*notion.BlockUpdateRequest, error) {
+	request := &notion.BlockUpdateRequest{}
+	fields := reflect.ValueOf(request).Elem()
+	source := reflect.ValueOf(b).Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		if value := source.FieldByName(fields.Type().Field(i).Name); value.IsValid() && value.Type() == field.Type().Elem() {
+			field.Set(reflect.New(value.Type()))
+			field.Elem().Set(value)
+			return request, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot revert a %s block", b.GetType())
+}
+
+// sameContent reports whether two blocks would be updated to the same thing.
+func sameContent(a, b notion.Block) bool {
+	ra, errA := updateRequest(a)
+	rb, errB := updateRequest(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	ja, errA := json.Marshal(ra)
+	jb, errB := json.Marshal(rb)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+func undoChange(client NotionAPI, c Change, force bool) error {
+	ctx := context.Background()
+	switch c.Kind {
+	case ChangeCreated:
+		if current, err := client.GetBlock(ctx, c.BlockID); err != nil {
+			return err
+		} else if current.GetArchived() {
+			return nil
+		}
+		_, err := client.DeleteBlock(ctx, c.BlockID)
+		return err
+	case ChangeDeleted:
+		_, err := client.RestoreBlock(ctx, c.BlockID)
+		return err
+	case ChangeUpdated:
+		current, err := client.GetBlock(ctx, c.BlockID)
+		if err != nil {
+			return err
+		} else if current.GetArchived() {
+			return errors.New("it was deleted since")
+		}
+		before, err := decodeBlock(c.Before)
+		if err != nil {
+			return err
+		}
+		if after, err := decodeBlock(c.After); err != nil {
+			return err
+		} else if !force && !sameContent(current, after) {
+			return errors.New("it was edited since (use --force to revert anyway)")
+		}
+		request, err := updateRequest(before)
+		if err != nil {
+			return err
+		}
+		_, err = client.UpdateBlock(ctx, c.BlockID, request)
+		return err
+	default:
+		return fmt.Errorf("unknown change `%s`", c.Kind)
+	}
+}
+
+// Undo reverts the last recorded command: deleted blocks are restored,
+// created ones deleted and updated ones set back to their previous content.
+// If it fails midway, the changes not yet reverted stay in the history.
+// Undo itself is not recorded.
+func Undo(client NotionAPI, force bool) error {
+	if Offline {
+		return errOfflineEdit
+	}
+	if h, ok := client.(historyClient); ok {
+		client = h.NotionAPI
+	}
+	h, err := LoadHistory()
+	if err != nil {
+		return err
+	}
+	if len(h.Operations) == 0 {
+		fmt.Println("nothing to undo")
+		return nil
+	}
+	op := &h.Operations[len(h.Operations)-1]
+	for i := len(op.Changes) - 1; i >= 0; i-- {
+		c := op.Changes[i]
+		if err := undoChange(client, c, force); err != nil {
+			if DryRun {
+				return err
+			}
+			op.Changes = op.Changes[:i+1]
+			if err := h.Save(); err != nil {
+				return err
+			}
+			return fmt.Errorf("cannot undo `%s`, failed to revert %s `%s`: %w", op.Command, c.Kind, c.Text, err)
+		}
+	}
+	if DryRun {
+		return nil
+	}
+	command := op.Command
+	h.Operations = h.Operations[:len(h.Operations)-1]
+	if err := h.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("%s✓ undid `%s`%s\n", utils.ColorGreen, command, utils.ColorReset)
+	return nil
+}
+
+// ShowHistory lists the commands that can be undone, the next one first.
+func ShowHistory() error {
+	h, err := LoadHistory()
+	if err != nil {
+		return err
+	}
+	if len(h.Operations) == 0 {
+		fmt.Println("nothing to undo")
+		return nil
+	}
+	for i := len(h.Operations) - 1; i >= 0; i-- {
+		op := h.Operations[i]
+		fmt.Printf("%s%s%s  %s\n", utils.HiDim, op.Time.Local().Format("Jan 02 15:04"), utils.HiReset, op.Command)
+		for _, c := range op.Changes {
+			fmt.Printf("    %-7s  %s\n", c.Kind, c.Text)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	notion "github.com/jomei/notionapi"
+)
+
+// blockCounter counts the blocks fetched one by one.
+type blockCounter struct {
+	NotionAPI
+	gets int
+}
+
+func (c *blockCounter) GetBlock(ctx context.Context, id notion.BlockID) (notion.Block, error) {
+	c.gets++
+	return c.NotionAPI.GetBlock(ctx, id)
+}
+
+// takeRecorded returns the changes recorded so far, forgetting them.
+func takeRecorded() []Change {
+	recorded.Lock()
+	defer recorded.Unlock()
+	changes := recorded.changes
+	recorded.changes = nil
+	return changes
+}
+
+func TestHistoryOfUpdates(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(client NotionAPI, pageID string) error
+		// the text before and after of every update recorded
+		want [][2]string
+		gets int
+	}{
+		{
+			name: "mod",
+			run: func(client NotionAPI, pageID string) error {
+				return ModifyStack(client, pageID, Selector{Keys: []string{"1"}}, "buy oat milk", nil)
+			},
+			want: [][2]string{{"buy milk", "buy oat milk"}},
+		},
+		{
+			name: "toggle with sub-tasks",
+			run: func(client NotionAPI, pageID string) error {
+				return ToggleStack(client, pageID, Selector{Keys: []string{"2"}}, true)
+			},
+			want: [][2]string{{"release", "release"}, {"tag", "tag"}},
+		},
+		{
+			name: "an update without the block read before",
+			run: func(client NotionAPI, pageID string) error {
+				blocks, err := GetStackEntries(client, pageID)
+				if err != nil {
+					return err
+				}
+				_, err = client.UpdateBlock(context.Background(), blocks[0].GetID(), &notion.BlockUpdateRequest{
+					ToDo: &notion.ToDo{RichText: text("buy bread")},
+				})
+				return err
+			},
+			want: [][2]string{{"buy milk", "buy bread"}},
+			gets: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, pageID := newStack(t, todo("buy milk", false), todo("release", false, todo("tag", false)))
+			counter := &blockCounter{NotionAPI: f}
+			takeRecorded()
+			if err := tt.run(historyClient{counter}, pageID); err != nil {
+				t.Fatal(err)
+			}
+			got := [][2]string{}
+			for _, c := range takeRecorded() {
+				if c.Kind != ChangeUpdated {
+					t.Fatalf("recorded a %s change", c.Kind)
+				}
+				before, err := decodeBlock(c.Before)
+				if err != nil {
+					t.Fatal(err)
+				}
+				after, err := decodeBlock(c.After)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, [2]string{RichText2Plain(BlockRichText(before)), RichText2Plain(BlockRichText(after))})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recorded updates %q, want %q", got, tt.want)
+			}
+			if counter.gets != tt.gets {
+				t.Errorf("fetched %d blocks, want %d", counter.gets, tt.gets)
+			}
+		})
+	}
+}
+
+func TestSaveHistory(t *testing.T) {
+	tests := []struct {
+		name   string
+		dryRun bool
+		run    func(client NotionAPI, pageID string) error
+		want   []string
+	}{
+		{
+			name: "a change",
+			run: func(client NotionAPI, pageID string) error {
+				return AddToStack(client, pageID, "call bob", nil)
+			},
+			want: []string{"nogo s a call bob"},
+		},
+		{
+			name: "no change",
+			run: func(client NotionAPI, pageID string) error {
+				_, err := GetStackEntries(client, pageID)
+				return err
+			},
+			want: []string{},
+		},
+		{
+			name:   "a dry run",
+			dryRun: true,
+			run: func(client NotionAPI, pageID string) error {
+				return AddToStack(client, pageID, "call bob", nil)
+			},
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+			defer func(dryRun bool) { DryRun = dryRun }(DryRun)
+			DryRun = tt.dryRun
+			f, pageID := newStack(t, todo("buy milk", false))
+			takeRecorded()
+			// straight to the history, to check it is not saved in a dry run
+			// even if a change got recorded
+			if err := tt.run(historyClient{f}, pageID); err != nil {
+				t.Fatal(err)
+			} else if err := SaveHistory("nogo s a call bob"); err != nil {
+				t.Fatal(err)
+			}
+			h, err := LoadHistory()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, op := range h.Operations {
+				got = append(got, op.Command)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("history %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -104,6 +104,96 @@ func (p *ParseTemplate) ReadOrUpdateParameter(param string, default_value string
 	}
 }
 
+func (p *ParseTemplate) getTable(key string) map[string]string {
+	table := map[string]string{}
+	if raw, ok := p.configs[key].(map[string]interface{}); ok {
+		for name, value := range raw {
+			if value_str, ok := value.(string); ok {
+				table[name] = value_str
+			}
+		}
+	}
+	return table
+}
+
+func (p *ParseTemplate) setTableEntry(key, name, value string) {
+	table := map[string]interface{}{}
+	for n, v := range p.getTable(key) {
+		table[n] = v
+	}
+	table[name] = value
+	p.configs[key] = table
+}
+
+func (p *ParseTemplate) GetStacks() map[string]string {
+	return p.getTable("stacks")
+}
+
+func (p *ParseTemplate) GetAliases() map[string]string {
+	return p.getTable("aliases")
+}
+
+func (p *ParseTemplate) SetAlias(name, id string) error {
+	p.setTableEntry("aliases", name, id)
+	return p.WriteToFile()
+}
+
+// GetAutoArchiveAfter is the age (e.g. `7d`) after which checked stack entries
+// are archived automatically, empty if they are not.
+func (p *ParseTemplate) GetAutoArchiveAfter() string {
+	if after, ok := p.configs["auto_archive_after"].(string); ok && after != "off" {
+		return after
+	}
+	return ""
+}
+
+func (p *ParseTemplate) SetAutoArchiveAfter(after string) error {
+	if after == "" || after == "off" {
+		delete(p.configs, "auto_archive_after")
+	} else {
+		p.configs["auto_archive_after"] = after
+	}
+	return p.WriteToFile()
+}
+
+func (p *ParseTemplate) GetDefaultStack() string {
+	if name, ok := p.configs["default_stack"].(string); ok {
+		return name
+	}
+	if stacks := p.GetStacks(); len(stacks) == 1 {
+		for name := range stacks {
+			return name
+		}
+	}
+	return ""
+}
+
+func (p *ParseTemplate) GetStackID(name string) (string, error) {
+	stacks := p.GetStacks()
+	if name == "" {
+		name = p.GetDefaultStack()
+	}
+	if name == "" {
+		if len(stacks) > 0 {
+			return "", fmt.Errorf("no default stack set, pick one with `--stack`")
+		}
+		return p.GetSecret("stack_page_id")
+	}
+	if id, ok := stacks[name]; !ok {
+		return "", fmt.Errorf("stack `%s` not registered", name)
+	} else {
+		return id, nil
+	}
+}
+
+func (p *ParseTemplate) SetStack(name, id string, makeDefault bool) error {
+	p.setTableEntry("stacks", name, id)
+	if _, ok := p.configs["default_stack"]; makeDefault || !ok {
+		p.configs["default_stack"] = name
+	}
+	return p.WriteToFile()
+}
+
 func StoreSecret(fname, param, value, key string) error {
 	v := goencode.File(key, fname)
 	return v.Set(param, value)
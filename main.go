@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"sort"
@@ -11,9 +12,120 @@ import (
 
 	notion "github.com/haykh/nogo/api"
 
+	notionapi "github.com/jomei/notionapi"
 	"github.com/urfave/cli/v2"
 )
 
+var matchFlag = &cli.StringSliceFlag{
+	Name:    "match",
+	Aliases: []string{"M"},
+	Usage:   "select entries containing the substring (case-insensitive)",
+}
+
+// filterFlags narrow the stack entries shown, or acted on by toggle, rm and
+// mod.
+func filterFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "tag",
+			Usage: "only entries with this #tag (repeatable)",
+		},
+		&cli.BoolFlag{
+			Name:  "overdue",
+			Usage: "only unchecked entries past their due date",
+		},
+		&cli.StringFlag{
+			Name:    "grep",
+			Aliases: []string{"g"},
+			Usage:   "only entries containing the text (case-insensitive)",
+		},
+		&cli.StringFlag{
+			Name:  "regex",
+			Usage: "only entries matching the regular expression",
+		},
+		&cli.StringFlag{
+			Name:  "fuzzy",
+			Usage: "only entries containing the letters in order (case-insensitive)",
+		},
+		&cli.BoolFlag{
+			Name:  "done",
+			Usage: "only checked entries",
+		},
+		&cli.BoolFlag{
+			Name:  "todo",
+			Usage: "only unchecked entries",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "at most this many entries",
+		},
+	}
+}
+
+// queryFromFlags merges the filters given to the stack with those given to
+// its subcommand (which win), e.g. `nogo s --grep milk rm`.
+func queryFromFlags(cCtx *cli.Context) notion.StackQuery {
+	return notion.StackQuery{
+		Sort:    flagContext(cCtx, "sort").String("sort"),
+		Tags:    flagContext(cCtx, "tag").StringSlice("tag"),
+		Overdue: flagContext(cCtx, "overdue").Bool("overdue"),
+		Grep:    flagContext(cCtx, "grep").String("grep"),
+		Regex:   flagContext(cCtx, "regex").String("regex"),
+		Fuzzy:   flagContext(cCtx, "fuzzy").String("fuzzy"),
+		Done:    flagContext(cCtx, "done").Bool("done"),
+		Todo:    flagContext(cCtx, "todo").Bool("todo"),
+		Limit:   flagContext(cCtx, "limit").Int("limit"),
+	}
+}
+
+func selectorFromArgs(cCtx *cli.Context) notion.Selector {
+	return notion.Selector{
+		Keys:   cCtx.Args().Slice(),
+		Match:  cCtx.StringSlice("match"),
+		Filter: queryFromFlags(cCtx),
+	}
+}
+
+var dueFlag = &cli.StringFlag{
+	Name:    "due",
+	Aliases: []string{"d"},
+	Usage:   "due date, e.g. 2026-11-01, tomorrow, \"next friday 9am\", \"in 3 days\", eod",
+}
+
+// dueFromFlag resolves --due against the local clock, nil if not given.
+func dueFromFlag(cCtx *cli.Context) (*notionapi.Date, error) {
+	if !cCtx.IsSet("due") {
+		return nil, nil
+	}
+	return notion.ParseNaturalDate(cCtx.String("due"), notion.Now())
+}
+
+func outputFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Value:   "text",
+		Usage:   "output format: text, json, yaml or tsv",
+	}
+}
+
+// flagContext finds the level (command or one of its parents) a flag defined
+// on several of them was actually set on, the innermost if none.
+func flagContext(cCtx *cli.Context, name string) *cli.Context {
+	for _, c := range cCtx.Lineage() {
+		if c.IsSet(name) {
+			return c
+		}
+	}
+	return cCtx
+}
+
+// globalString reads a flag that is defined both on the app and on a command,
+// preferring whichever level it was actually set on.
+func globalString(cCtx *cli.Context, name string) string {
+	return flagContext(cCtx, name).String(name)
+}
+
 func main() {
 	log.SetPrefix("[ nogo ERROR ]: ")
 	log.SetFlags(0)
@@ -56,6 +168,9 @@ GLOBAL OPTIONS:
 		}
 	}
 
+	// command labels the changes in the history: the command and its
+	// arguments, without the global flags
+	command := "nogo"
 	app := &cli.App{
 		Name:     "nogo",
 		Version:  "1.6.0",
@@ -64,6 +179,54 @@ GLOBAL OPTIONS:
 			Name: "@haykh",
 		}},
 		Usage: "do awesome stuff with notion from a cli",
+		Flags: []cli.Flag{
+			outputFlag(),
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "give up on notion requests after this long (e.g. 30s; no limit if omitted)",
+			},
+			&cli.IntFlag{
+				Name:  "concurrency",
+				Value: notion.Concurrency,
+				Usage: "number of parallel requests when fetching nested blocks",
+			},
+			&cli.BoolFlag{
+				Name:  "offline",
+				Usage: "render pages from the local cache only, without talking to notion",
+			},
+			&cli.BoolFlag{
+				Name:  "refresh",
+				Usage: "ignore the local cache and fetch pages again",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "print the changes a command would make to notion without making them",
+			},
+		},
+		Before: func(cCtx *cli.Context) error {
+			if cCtx.Int("concurrency") < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+			notion.Concurrency = cCtx.Int("concurrency")
+			notion.Timeout = cCtx.Duration("timeout")
+			if cCtx.Bool("offline") && cCtx.Bool("refresh") {
+				return fmt.Errorf("--offline and --refresh cannot be combined")
+			}
+			notion.Offline = cCtx.Bool("offline")
+			notion.Refresh = cCtx.Bool("refresh")
+			notion.DryRun = cCtx.Bool("dry-run")
+			command = strings.Join(append([]string{"nogo"}, cCtx.Args().Slice()...), " ")
+			return nil
+		},
+		After: func(cCtx *cli.Context) error {
+			if err := notion.SaveCache(); err != nil {
+				return err
+			}
+			if notion.DryRun {
+				notion.ShowPlan()
+			}
+			return nil
+		},
 		Action: func(cCtx *cli.Context) error {
 			return cli.ShowAppHelp(cCtx)
 		},
@@ -77,75 +240,440 @@ GLOBAL OPTIONS:
 					return err
 				},
 			},
+			{
+				Name:      "export",
+				Aliases:   []string{"e"},
+				Usage:     "export a page (or a page tree) to markdown",
+				ArgsUsage: "<page-url-or-id>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Value:   "md",
+						Usage:   "export format (md)",
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "file (or directory with --recursive) to write to (stdout if omitted)",
+					},
+					&cli.BoolFlag{
+						Name:    "recursive",
+						Aliases: []string{"r"},
+						Usage:   "export child pages and databases into a directory tree",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.NArg() != 1 {
+						return fmt.Errorf("expected <page-url-or-id>, got %d args", cCtx.NArg())
+					}
+					if pageID, err := notion.ParseID(cCtx.Args().First()); err != nil {
+						return err
+					} else if client, _, err := notion.InitClient(); err != nil {
+						return err
+					} else {
+						return notion.ExportPage(client, pageID, cCtx.String("format"), cCtx.String("out"), cCtx.Bool("recursive"))
+					}
+				},
+			},
+			{
+				Name:      "import",
+				Aliases:   []string{"i"},
+				Usage:     "import a markdown file into notion",
+				ArgsUsage: "<file.md>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "parent",
+						Aliases:  []string{"p"},
+						Usage:    "url or id of the parent page",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:    "title",
+						Aliases: []string{"t"},
+						Usage:   "title of the new page (leading `# heading` or file name if omitted)",
+					},
+					&cli.BoolFlag{
+						Name:  "into",
+						Usage: "append the blocks to the parent page instead of creating a new page",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.NArg() != 1 {
+						return fmt.Errorf("expected <file.md>, got %d args", cCtx.NArg())
+					}
+					if parentID, err := notion.ParseID(cCtx.String("parent")); err != nil {
+						return err
+					} else if client, _, err := notion.InitClient(); err != nil {
+						return err
+					} else {
+						return notion.ImportMarkdown(client, parentID, cCtx.Args().First(), cCtx.String("title"), cCtx.Bool("into"))
+					}
+				},
+			},
+			{
+				Name:  "sync",
+				Usage: "send the changes made offline to notion",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "apply changes even to entries edited remotely in the meantime",
+					},
+					&cli.BoolFlag{
+						Name:  "discard",
+						Usage: "drop changes to entries edited remotely in the meantime",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.Bool("force") && cCtx.Bool("discard") {
+						return fmt.Errorf("--force and --discard cannot be combined")
+					}
+					if client, _, err := notion.InitClient(); err != nil {
+						return err
+					} else {
+						return notion.Sync(client, cCtx.Bool("force"), cCtx.Bool("discard"))
+					}
+				},
+			},
+			{
+				Name:  "undo",
+				Usage: "revert the last command that changed notion",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "list",
+						Aliases: []string{"l"},
+						Usage:   "list the commands that can be undone, most recent first",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "revert entries even if they were edited since",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					if cCtx.Bool("list") {
+						return notion.ShowHistory()
+					}
+					if client, _, err := notion.InitClient(); err != nil {
+						return err
+					} else {
+						return notion.Undo(client, cCtx.Bool("force"))
+					}
+				},
+			},
+			{
+				Name:    "page",
+				Aliases: []string{"p"},
+				Usage:   "view arbitrary pages",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "show",
+						Usage:     "render a page",
+						ArgsUsage: "<alias|page-url-or-id>",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:    "depth",
+								Aliases: []string{"d"},
+								Usage:   "levels of toggles, columns and child pages to expand (all toggles and columns, no child pages if omitted)",
+							},
+							outputFlag(),
+						},
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.NArg() != 1 {
+								return fmt.Errorf("expected <alias|page-url-or-id>, got %d args", cCtx.NArg())
+							}
+							depth := -1
+							if cCtx.IsSet("depth") {
+								depth = max(cCtx.Int("depth"), 0)
+							}
+							if format, err := notion.ParseOutputFormat(globalString(cCtx, "output")); err != nil {
+								return err
+							} else if client, loc_config, err := notion.InitClient(); err != nil {
+								return err
+							} else if pageID, err := notion.ResolvePageRef(loc_config, cCtx.Args().First()); err != nil {
+								return err
+							} else if client, err := notion.NewCacheClient(client, pageID); err != nil {
+								return err
+							} else {
+								return notion.ShowPageAs(client, pageID, format, depth)
+							}
+						},
+					},
+					{
+						Name:      "alias",
+						Usage:     "save a short name for a page",
+						ArgsUsage: "<name> <page-url-or-id>",
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.NArg() != 2 {
+								return fmt.Errorf("expected <name> <page-url-or-id>, got %d args", cCtx.NArg())
+							}
+							if client, loc_config, err := notion.InitClient(); err != nil {
+								return err
+							} else {
+								return notion.SaveAlias(client, loc_config, cCtx.Args().Get(0), cCtx.Args().Get(1))
+							}
+						},
+					},
+				},
+			},
+			{
+				Name:      "search",
+				Aliases:   []string{"f"},
+				Usage:     "search pages and databases, most recently edited first",
+				ArgsUsage: "[query]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "type",
+						Aliases: []string{"t"},
+						Usage:   "only `page` or `database` results (both if omitted)",
+					},
+					&cli.IntFlag{
+						Name:    "limit",
+						Aliases: []string{"n"},
+						Usage:   "results fetched at once (at most 100)",
+						Value:   20,
+					},
+					&cli.BoolFlag{
+						Name:    "all",
+						Aliases: []string{"a"},
+						Usage:   "fetch every result instead of the first page",
+					},
+					&cli.BoolFlag{
+						Name:    "pick",
+						Aliases: []string{"p"},
+						Usage:   "pick a result to open or save as an alias",
+					},
+					outputFlag(),
+				},
+				Action: func(cCtx *cli.Context) error {
+					query := notion.SearchQuery{
+						Text:     strings.Join(cCtx.Args().Slice(), " "),
+						Type:     cCtx.String("type"),
+						PageSize: cCtx.Int("limit"),
+						All:      cCtx.Bool("all"),
+					}
+					if format, err := notion.ParseOutputFormat(globalString(cCtx, "output")); err != nil {
+						return err
+					} else if client, loc_config, err := notion.InitClient(); err != nil {
+						return err
+					} else {
+						return notion.ShowSearch(client, loc_config, query, format, cCtx.Bool("pick"))
+					}
+				},
+			},
 			{
 				Name:                   "stack",
 				Aliases:                []string{"s"},
 				Usage:                  "interact with the stack (todo list)",
 				UseShortOptionHandling: true,
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "stack",
+						Usage: "name of the registered stack to use (default stack if omitted)",
+					},
+					outputFlag(),
+					&cli.StringFlag{
+						Name:  "sort",
+						Usage: "order entries by `due` date or `priority`",
+					},
+				}, filterFlags()...),
 				Action: func(cCtx *cli.Context) error {
-					if client, sID, err := notion.InitAPI(); err != nil {
+					query := queryFromFlags(cCtx)
+					if format, err := notion.ParseOutputFormat(globalString(cCtx, "output")); err != nil {
+						return err
+					} else if client, loc_config, sID, err := notion.InitStack(cCtx.String("stack")); err != nil {
 						return err
 					} else {
-						return notion.ShowPage(client, sID)
+						// structured output feeds scripts, which should not change the stack
+						if format == notion.OutputText {
+							if err := notion.AutoArchive(client, loc_config, sID); err != nil {
+								return err
+							}
+						}
+						return notion.ShowStack(client, sID, format, query)
 					}
 				},
 				Subcommands: []*cli.Command{
 					{
-						Name:    "add",
-						Aliases: []string{"a"},
-						Usage:   "add a new entry to the stack",
+						Name:      "add",
+						Aliases:   []string{"a"},
+						Usage:     "add a new entry to the stack",
+						ArgsUsage: "[entry]",
+						Flags:     []cli.Flag{dueFlag},
 						Action: func(cCtx *cli.Context) error {
-							if client, sID, err := notion.InitAPI(); err != nil {
+							if due, err := dueFromFlag(cCtx); err != nil {
+								return err
+							} else if client, sID, err := notion.InitAPI(cCtx.String("stack")); err != nil {
 								return err
 							} else {
-								return notion.AddToStack(client, sID)
+								return notion.AddToStack(client, sID, strings.Join(cCtx.Args().Slice(), " "), due)
 							}
 						},
 					},
 					{
-						Name:    "mod",
-						Aliases: []string{"m"},
-						Usage:   "modify a stack entry",
+						Name:      "mod",
+						Aliases:   []string{"m"},
+						Usage:     "modify a stack entry",
+						ArgsUsage: "[index|id] [new entry]",
+						Flags:     append([]cli.Flag{matchFlag, dueFlag}, filterFlags()...),
 						Action: func(cCtx *cli.Context) error {
-							if client, sID, err := notion.InitAPI(); err != nil {
+							if due, err := dueFromFlag(cCtx); err != nil {
+								return err
+							} else if client, sID, err := notion.InitAPI(cCtx.String("stack")); err != nil {
 								return err
 							} else {
-								return notion.ModifyStack(client, sID)
+								sel := notion.Selector{Match: cCtx.StringSlice("match"), Filter: queryFromFlags(cCtx)}
+								args := cCtx.Args().Slice()
+								// with --match or a filter, all arguments are the new entry
+								if len(sel.Match) == 0 && sel.Filter.IsEmpty() && len(args) > 0 {
+									sel.Keys, args = args[:1], args[1:]
+								}
+								return notion.ModifyStack(client, sID, sel, strings.Join(args, " "), due)
 							}
 						},
 					},
 					{
-						Name:    "toggle",
-						Aliases: []string{"t"},
-						Usage:   "toggle stack entries",
+						Name:      "toggle",
+						Aliases:   []string{"t"},
+						Usage:     "toggle stack entries",
+						ArgsUsage: "[index|id ...]",
+						Flags: append([]cli.Flag{
+							matchFlag,
+							&cli.BoolFlag{
+								Name:    "subtasks",
+								Aliases: []string{"s"},
+								Usage:   "also check/uncheck the sub-tasks of toggled entries",
+							},
+						}, filterFlags()...),
 						Action: func(cCtx *cli.Context) error {
-							if client, sID, err := notion.InitAPI(); err != nil {
+							if client, sID, err := notion.InitAPI(cCtx.String("stack")); err != nil {
 								return err
 							} else {
-								return notion.ToggleStack(client, sID)
+								return notion.ToggleStack(client, sID, selectorFromArgs(cCtx), cCtx.Bool("subtasks"))
 							}
 						},
 					},
 					{
-						Name:    "rnd",
-						Usage:   "select a random unfinished task from the stack",
+						Name:      "move",
+						Aliases:   []string{"mv"},
+						Usage:     "move stack entries (interactively if none given)",
+						ArgsUsage: "[index|id ...]",
+						Flags: []cli.Flag{
+							matchFlag,
+							&cli.BoolFlag{
+								Name:  "top",
+								Usage: "move the entries to the top",
+							},
+							&cli.BoolFlag{
+								Name:  "bottom",
+								Usage: "move the entries to the bottom",
+							},
+							&cli.StringFlag{
+								Name:  "after",
+								Usage: "move the entries after this entry (index or id)",
+							},
+						},
 						Action: func(cCtx *cli.Context) error {
-							if client, sID, err := notion.InitAPI(); err != nil {
+							if client, sID, err := notion.InitAPI(cCtx.String("stack")); err != nil {
 								return err
 							} else {
-                return notion.RandomStackEntry(client, sID)
+								return notion.MoveStack(client, sID, selectorFromArgs(cCtx), notion.Placement{
+									Top:    cCtx.Bool("top"),
+									Bottom: cCtx.Bool("bottom"),
+									After:  cCtx.String("after"),
+								})
 							}
 						},
 					},
 					{
-						Name:    "rm",
-						Aliases: []string{"r"},
-						Usage:   "remove stack entries",
+						Name:  "archive",
+						Usage: "move checked entries to the `Done` page, grouped by week",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "older-than",
+								Usage: "only archive entries checked at least this long ago (e.g. 7d, 2w, 36h)",
+							},
+							&cli.StringFlag{
+								Name:  "auto-archive-after",
+								Usage: "archive checked entries this long after checking them whenever the stack is shown as text (`off` to disable)",
+							},
+						},
+						Action: func(cCtx *cli.Context) error {
+							if cCtx.IsSet("auto-archive-after") {
+								if loc_config, err := config.CreateOrReadLocalConfig(true); err != nil {
+									return err
+								} else {
+									return notion.SetAutoArchiveAfter(loc_config, cCtx.String("auto-archive-after"))
+								}
+							}
+							olderThan := time.Duration(0)
+							if cCtx.IsSet("older-than") {
+								if age, err := notion.ParseAge(cCtx.String("older-than")); err != nil {
+									return err
+								} else {
+									olderThan = age
+								}
+							}
+							if client, sID, err := notion.InitAPI(cCtx.String("stack")); err != nil {
+								return err
+							} else {
+								return notion.ShowArchiveStack(client, sID, olderThan)
+							}
+						},
+					},
+					{
+						Name:  "rnd",
+						Usage: "select a random unfinished task from the stack",
+						Action: func(cCtx *cli.Context) error {
+							if client, sID, err := notion.InitAPI(cCtx.String("stack")); err != nil {
+								return err
+							} else {
+								return notion.RandomStackEntry(client, sID)
+							}
+						},
+					},
+					{
+						Name:    "list",
+						Aliases: []string{"ls"},
+						Usage:   "list registered stacks",
+						Action: func(cCtx *cli.Context) error {
+							if loc_config, err := config.CreateOrReadLocalConfig(true); err != nil {
+								return err
+							} else {
+								return notion.ShowStacks(loc_config)
+							}
+						},
+					},
+					{
+						Name:      "register",
+						Usage:     "register a page as a named stack",
+						ArgsUsage: "<name> <page-url-or-id>",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "default",
+								Usage: "make it the default stack",
+							},
+						},
 						Action: func(cCtx *cli.Context) error {
-							if client, sID, err := notion.InitAPI(); err != nil {
+							if cCtx.NArg() != 2 {
+								return fmt.Errorf("expected <name> <page-url-or-id>, got %d args", cCtx.NArg())
+							}
+							if client, loc_config, err := notion.InitClient(); err != nil {
 								return err
 							} else {
-								return notion.RmFromStack(client, sID)
+								return notion.RegisterStack(client, loc_config, cCtx.Args().Get(0), cCtx.Args().Get(1), cCtx.Bool("default"))
+							}
+						},
+					},
+					{
+						Name:      "rm",
+						Aliases:   []string{"r"},
+						Usage:     "remove stack entries",
+						ArgsUsage: "[index|id ...]",
+						Flags:     append([]cli.Flag{matchFlag}, filterFlags()...),
+						Action: func(cCtx *cli.Context) error {
+							if client, sID, err := notion.InitAPI(cCtx.String("stack")); err != nil {
+								return err
+							} else {
+								return notion.RmFromStack(client, sID, selectorFromArgs(cCtx))
 							}
 						},
 					},
@@ -157,7 +685,10 @@ GLOBAL OPTIONS:
 	sort.Sort(cli.FlagsByName(app.Flags))
 	sort.Sort(cli.CommandsByName(app.Commands))
 
+	// only commands that went through are kept for `nogo undo`
 	if err := app.Run(os.Args); err != nil {
 		log.Fatal(err)
+	} else if err := notion.SaveHistory(command); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	notion "github.com/haykh/nogo/api"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestQueryFromFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want notion.StackQuery
+	}{
+		{[]string{"s", "rm"}, notion.StackQuery{}},
+		{[]string{"s", "--grep", "milk", "rm"}, notion.StackQuery{Grep: "milk"}},
+		{[]string{"s", "--tag", "home", "--sort", "due", "rm", "--todo"}, notion.StackQuery{Sort: "due", Tags: []string{"home"}, Todo: true}},
+		// the subcommand wins
+		{[]string{"s", "--grep", "milk", "--limit", "2", "rm", "--grep", "bread"}, notion.StackQuery{Grep: "bread", Limit: 2}},
+	}
+	for _, tt := range tests {
+		var got notion.StackQuery
+		app := &cli.App{Commands: []*cli.Command{{
+			Name: "s",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{Name: "sort"},
+			}, filterFlags()...),
+			Subcommands: []*cli.Command{{
+				Name:  "rm",
+				Flags: filterFlags(),
+				Action: func(cCtx *cli.Context) error {
+					got = queryFromFlags(cCtx)
+					return nil
+				},
+			}},
+		}}}
+		if err := app.Run(append([]string{"nogo"}, tt.args...)); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %+v, want %+v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	survey "github.com/AlecAivazis/survey/v2"
+	"golang.org/x/term"
 )
 
 type MessageType int64
@@ -37,6 +39,7 @@ const (
 
 const (
 	HiStrike HighlightType = "\033[9m"
+	HiDim    HighlightType = "\033[2m"
 	HiReset  HighlightType = "\033[0m"
 )
 
@@ -51,16 +54,28 @@ func IsIn[T cmp.Ordered](element T, array []T) bool {
 
 func Clean(str string) string {
 	colors := []ColorType{ColorReset, ColorRed, ColorGreen, ColorBlue, ColorCyan, ColorYellow, ColorPurple, ColorGray}
-	highlights := []HighlightType{HiStrike, HiReset}
+	highlights := []HighlightType{HiStrike, HiDim, HiReset}
 	for _, c := range colors {
 		str = strings.ReplaceAll(str, c, "")
 	}
 	for _, h := range highlights {
 		str = strings.ReplaceAll(str, h, "")
 	}
+	str = hyperlinkPattern.ReplaceAllString(str, "")
 	return strings.Trim(str, " \n")
 }
 
+var hyperlinkPattern = regexp.MustCompile("\033\\]8;[^\033]*\033\\\\")
+
+// Hyperlink wraps the text into an OSC 8 terminal hyperlink when stdout is a
+// terminal.
+func Hyperlink(url, text string) string {
+	if url == "" || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return text
+	}
+	return "\033]8;;" + url + "\033\\" + text + "\033]8;;\033\\"
+}
+
 func CreateFile(fname string) error {
 	f, err := func(p string) (*os.File, error) {
 		if err := os.MkdirAll(filepath.Dir(p), 0770); err != nil {
@@ -99,6 +114,19 @@ func Message(msg string, msgtype MessageType, newline bool, color ...ColorType)
 	}
 }
 
+// TerminalWidth is the width of the terminal on stdout, 0 if it is not one.
+func TerminalWidth() int {
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err != nil {
+		return 0
+	} else {
+		return width
+	}
+}
+
+func IsInteractive() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
 func PromptBool(msg string, def bool) (bool, error) {
 	val := false
 	prompt := &survey.Confirm{